@@ -1,15 +1,24 @@
 package home
 
 import (
+	"github.com/sonyarianto/gobete/internal/systems/container"
 	"github.com/sonyarianto/gobete/internal/systems/response"
 
-	"os"
-
 	"github.com/gofiber/fiber/v2"
 )
 
-func HomeHandler(c *fiber.Ctx) error {
+// Service serves the home route
+type Service struct {
+	*container.Container
+}
+
+// NewService creates the home service with the dependencies of the container
+func NewService(c *container.Container) *Service {
+	return &Service{Container: c}
+}
+
+func (s *Service) HomeHandler(c *fiber.Ctx) error {
 	return response.SendSuccessResponse(c, "API is running", fiber.Map{
-		"version": os.Getenv("APP_VERSION"),
+		"version": s.Config.App.Version,
 	})
 }
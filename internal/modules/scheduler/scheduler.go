@@ -1,16 +1,31 @@
 package scheduler
 
 import (
-	"time"
-
 	"github.com/robfig/cron/v3"
-	"github.com/sonyarianto/gobete/internal/systems/db"
+	"github.com/sonyarianto/gobete/internal/systems/container"
+
+	"context"
+	"time"
 )
 
-func StartCleanupUserSessionScheduler() {
+func StartCleanupUserSessionScheduler(deps *container.Container) {
 	c := cron.New()
 	c.AddFunc("@every 1h", func() {
-		db.DB.Exec("DELETE FROM user_sessions WHERE expires_at < ?", time.Now())
+		deps.DB.Exec("DELETE FROM user_sessions WHERE expires_at < ?", deps.Clock())
+	})
+	c.AddFunc("@every 1h", func() {
+		deps.DB.Exec("DELETE FROM password_reset_tokens WHERE expires_at < ?", deps.Clock())
+		deps.DB.Exec("DELETE FROM email_verification_tokens WHERE expires_at < ?", deps.Clock())
+		deps.DB.Exec("DELETE FROM oauth_states WHERE expires_at < ?", deps.Clock())
+		// Expired API keys stay listed for a month, so their owners see why a script stopped working
+		deps.DB.Exec("DELETE FROM api_keys WHERE expires_at < ?", deps.Clock().AddDate(0, 0, -30))
+	})
+	c.AddFunc("@every 1h", func() {
+		// Failed logins are forgotten after a quiet window anyway, keep them a day for auditing
+		deps.DB.Exec("DELETE FROM login_throttles WHERE last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", deps.Clock().Add(-24*time.Hour), deps.Clock())
+	})
+	c.AddFunc("@every 1h", func() {
+		deps.Revocations.Cleanup(context.Background(), deps.Clock())
 	})
 	c.Start()
 }
@@ -0,0 +1,224 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+
+	"context"
+	"slices"
+)
+
+// Default page size for the admin user list
+const (
+	defaultUsersPerPage = 20
+)
+
+// attachRoles fills the Roles field of every user with one query
+func (s *Service) attachRoles(ctx context.Context, users []UserResponse) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(users))
+	for i, u := range users {
+		ids[i] = u.ID
+	}
+
+	rolesByUser, err := s.Roles.NamesByUser(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		users[i].Roles = rolesByUser[users[i].ID]
+		if users[i].Roles == nil {
+			users[i].Roles = []string{}
+		}
+	}
+
+	return nil
+}
+
+// findUserResponse fetches a single user for the admin API
+func (s *Service) findUserResponse(ctx context.Context, userID uint, includeDeleted bool) (*UserResponse, error) {
+	user, err := s.Users.FindResponse(ctx, userID, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	users := []UserResponse{*user}
+	if err := s.attachRoles(ctx, users); err != nil {
+		return nil, err
+	}
+	return &users[0], nil
+}
+
+func (s *Service) ListUsersHandler(c *fiber.Ctx) error {
+	var query ListUsersQuery
+	if err := c.QueryParser(&query); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "bad_request", "Invalid query parameters")
+	}
+
+	// Validate input
+	if err := validate.Struct(&query); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(query, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	if query.Page == 0 {
+		query.Page = 1
+	}
+	if query.PerPage == 0 {
+		query.PerPage = defaultUsersPerPage
+	}
+
+	// Newest first by default, "-" prefix means descending
+	if query.Sort == "" {
+		query.Sort = "-created_at"
+	}
+
+	users, total, err := s.Users.List(c.UserContext(), query)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query users")
+	}
+	if err := s.attachRoles(c.UserContext(), users); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user roles")
+	}
+
+	return response.SendPaginatedResponse(c, "Users fetched successfully", users, response.NewPagination(query.Page, query.PerPage, total))
+}
+
+func (s *Service) GetUserByIDHandler(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_user_id")
+	}
+
+	user, err := s.findUserResponse(c.UserContext(), uint(userID), c.QueryBool("include_deleted"))
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "user_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	return response.SendSuccessResponse(c, "User fetched successfully", user)
+}
+
+func (s *Service) UpdateUserByIDHandler(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_user_id")
+	}
+
+	var req AdminUpdateUserRequest
+
+	req = *c.Locals("body").(*AdminUpdateUserRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	user, err := s.Users.FindByID(c.UserContext(), uint(userID))
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "user_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Compared before the update, which writes the new email into user
+	emailChanged := req.Email != nil && *req.Email != user.Email
+
+	// Email must stay unique
+	if emailChanged {
+		exists, err := s.Users.EmailExists(c.UserContext(), *req.Email, true)
+		if err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+		}
+		if exists {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "user_exists")
+		}
+	}
+
+	// Roles must exist
+	var roles []Role
+	if req.Roles != nil {
+		roleNames := slices.Compact(slices.Sorted(slices.Values(*req.Roles)))
+		if roles, err = s.Roles.FindByNames(c.UserContext(), roleNames); err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query roles")
+		}
+		if len(roles) != len(roleNames) {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_role")
+		}
+	}
+
+	// Only update the fields that are present in the request
+	detailUpdate := UserDetailUpdate{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Phone:     req.Phone,
+		Bio:       req.Bio,
+		AvatarURL: req.AvatarURL,
+	}
+
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		// A changed email address has to be verified again
+		if emailChanged {
+			if err := s.Users.UpdateEmail(ctx, user.ID, *req.Email); err != nil {
+				return err
+			}
+		}
+
+		if err := s.Users.UpdateDetail(ctx, user.ID, detailUpdate); err != nil {
+			return err
+		}
+
+		if req.Roles != nil {
+			if err := s.Roles.Replace(ctx, user.ID, roles); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to update user")
+	}
+
+	// Issued tokens carry the old email and roles
+	if emailChanged || req.Roles != nil {
+		s.revokeUserTokens(c.UserContext(), user.ID)
+	}
+
+	updated, err := s.findUserResponse(c.UserContext(), user.ID, false)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	return response.SendSuccessResponse(c, "User updated successfully", updated)
+}
+
+func (s *Service) DeleteUserByIDHandler(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_user_id")
+	}
+
+	if err := s.deleteUserAndSessions(c.UserContext(), uint(userID)); err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "user_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to delete user")
+	}
+
+	return response.SendSuccessResponse(c, "User deleted successfully", nil)
+}
@@ -0,0 +1,43 @@
+package user
+
+import (
+	"slices"
+	"testing"
+)
+
+// The email and name filters match their text literally, % and _ are not LIKE wildcards
+func TestListUsersFiltersLiterally(t *testing.T) {
+	services := map[string]*Service{"memory": newTestService(t), "gorm": newTestGormService(t)}
+
+	tests := []struct {
+		query ListUsersQuery
+		want  []string
+	}{
+		{ListUsersQuery{Email: "a_b"}, []string{"a_b@example.com"}},
+		{ListUsersQuery{Email: "50%"}, []string{"50%off@example.com"}},
+		{ListUsersQuery{Email: "!"}, []string{"hey!@example.com"}},
+		{ListUsersQuery{Email: "EXAMPLE.COM"}, []string{"50%off@example.com", "50off@example.com", "a_b@example.com", "axb@example.com", "hey!@example.com"}},
+		{ListUsersQuery{Name: "d_e"}, nil},
+		{ListUsersQuery{Name: "doe"}, []string{"50%off@example.com", "50off@example.com", "a_b@example.com", "axb@example.com", "hey!@example.com"}},
+	}
+	for name, s := range services {
+		for _, email := range []string{"a_b@example.com", "axb@example.com", "50%off@example.com", "50off@example.com", "hey!@example.com"} {
+			addTestUser(t, s, email, true)
+		}
+
+		for _, tt := range tests {
+			tt.query.Page, tt.query.PerPage, tt.query.Sort = 1, 100, "email"
+			users, total, err := s.Users.List(t.Context(), tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, user := range users {
+				got = append(got, user.Email)
+			}
+			if !slices.Equal(got, tt.want) || total != int64(len(tt.want)) {
+				t.Errorf("%s repository, email %q name %q: got %v (total %d), want %v", name, tt.query.Email, tt.query.Name, got, total, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, it tells API keys and JWTs apart in the Authorization header
+const APIKeyPrefix = "gbt_"
+
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+func apiKeyResponse(key APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		LastUsedIP: key.LastUsedIP,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// AuthenticateAPIKey returns the principal of an API key. Roles are those of the user, permissions are the
+// key scopes the user still has, so removing a role from the user also narrows the keys.
+func (s *Service) AuthenticateAPIKey(ctx context.Context, raw string, ip string) (*token.Claims, error) {
+	key, err := s.APIKeys.FindByHash(ctx, hashOneTimeToken(raw))
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if s.Clock().After(key.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Keys of deleted users stop working with the user
+	user, err := s.Users.FindByID(ctx, key.UserID)
+	if err != nil {
+		if err == ErrNotFound {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	roles, permissions, err := s.GetUserRolesAndPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	scopes := strings.Fields(key.Scopes)
+	permissions = slices.DeleteFunc(permissions, func(permission string) bool {
+		return !slices.Contains(scopes, permission)
+	})
+
+	// Update last used at most once per minute, to avoid a write on every request
+	if key.LastUsedAt == nil || s.Clock().Sub(*key.LastUsedAt) > time.Minute {
+		s.APIKeys.Touch(ctx, key.ID, s.Clock(), ip)
+	}
+
+	return &token.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Type:          token.TypeAPIKey,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerifiedAt != nil,
+	}, nil
+}
+
+// IsAPIKeyPrincipal reports whether the request is authenticated with an API key instead of a login
+func IsAPIKeyPrincipal(c *fiber.Ctx) bool {
+	claims, ok := c.Locals("user").(*token.Claims)
+	return ok && claims.Type == token.TypeAPIKey
+}
+
+func (s *Service) ListAPIKeysHandler(c *fiber.Ctx) error {
+	apiKeys, err := s.APIKeys.ListByUser(c.UserContext(), currentUserID(c))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query API keys")
+	}
+
+	keys := make([]APIKeyResponse, len(apiKeys))
+	for i, key := range apiKeys {
+		keys[i] = apiKeyResponse(key)
+	}
+
+	return response.SendSuccessResponse(c, "API keys fetched successfully", keys)
+}
+
+// CreateAPIKeyHandler creates an API key, the key itself is only returned in this response
+func (s *Service) CreateAPIKeyHandler(c *fiber.Ctx) error {
+	var req CreateAPIKeyRequest
+
+	req = *c.Locals("body").(*CreateAPIKeyRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	userID := currentUserID(c)
+
+	// A key can only be scoped to permissions the user has
+	_, permissions, err := s.GetUserRolesAndPermissions(c.UserContext(), userID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user roles")
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(permissions, scope) {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_scope", fmt.Sprintf("Scope %q is not one of your permissions.", scope))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	expiresInDays := req.ExpiresInDays
+	if expiresInDays == 0 {
+		expiresInDays = s.Config.APIKey.DefaultExpireDays
+	}
+
+	secret, _, err := generateOneTimeToken()
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate API key")
+	}
+	raw := APIKeyPrefix + secret
+
+	now := s.Clock()
+	key := APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    raw[:len(APIKeyPrefix)+8],
+		KeyHash:   hashOneTimeToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: now.AddDate(0, 0, expiresInDays),
+		CreatedAt: now,
+	}
+	if err := s.APIKeys.Create(c.UserContext(), &key); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to create API key")
+	}
+
+	s.recordSecurityEvent(c, userID, SecurityEventAPIKeyCreated, "")
+
+	return response.SendSuccessResponse(c, "API key created successfully, copy it now as it is not shown again", fiber.Map{
+		"api_key": apiKeyResponse(key),
+		"key":     raw,
+	})
+}
+
+func (s *Service) RevokeAPIKeyHandler(c *fiber.Ctx) error {
+	keyID, err := c.ParamsInt("id")
+	if err != nil || keyID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "api_key_not_found")
+	}
+
+	userID := currentUserID(c)
+
+	deleted, err := s.APIKeys.Delete(c.UserContext(), userID, uint(keyID))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to revoke API key")
+	}
+	if !deleted {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "api_key_not_found")
+	}
+
+	s.recordSecurityEvent(c, userID, SecurityEventAPIKeyRevoked, "")
+
+	return response.SendSuccessResponse(c, "API key revoked successfully", nil)
+}
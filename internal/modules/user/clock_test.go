@@ -0,0 +1,51 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"net/http"
+	"testing"
+)
+
+// Records get their creation time from the service clock, not from the database driver, so expiry and
+// cooldown checks against the clock see consistent timestamps
+func TestRecordsCreatedAtServiceClock(t *testing.T) {
+	s := newTestGormService(t)
+	app := newTestApp(s)
+	user := addTestUser(t, s, "jane@example.com", true)
+	now := s.Clock()
+
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login status = %d (%s), want 200", res.Status, res.Code)
+	}
+	refreshToken, _ := res.Data["refresh_token"].(string)
+	do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken}) // Reuse, records an event
+
+	// A second device, whose session survives the reuse in the first one
+	login(t, app, "jane@example.com", testPassword)
+
+	s.sendPasswordReset(t.Context(), user)
+	if err := s.sendVerificationEmail(t.Context(), user); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.generateRecoveryCodes(t.Context(), user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"user_sessions", "password_reset_tokens", "email_verification_tokens", "mfa_recovery_codes", "security_events"} {
+		var createdAt []int64
+		if err := s.DB.Table(table).Select("CAST(strftime('%s', created_at) AS INTEGER)").Scan(&createdAt).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(createdAt) == 0 {
+			t.Errorf("%s: no records", table)
+		}
+		for _, got := range createdAt {
+			if got != now.Unix() {
+				t.Errorf("%s: created at %d, want the service clock %d", table, got, now.Unix())
+			}
+		}
+	}
+}
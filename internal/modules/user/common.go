@@ -1,10 +1,36 @@
 package user
 
 import (
-	"os"
-
 	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/container"
+	"github.com/sonyarianto/gobete/internal/systems/token"
 )
 
-var validate = validator.New(validator.WithRequiredStructEnabled())
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+var validate = newValidator()
+
+// Service serves the user, authentication and session endpoints
+type Service struct {
+	*container.Container
+	Repositories
+}
+
+// NewService creates the user service with the dependencies of the container, the user module
+// is stored in its database
+func NewService(c *container.Container) *Service {
+	return &Service{
+		Container:    c,
+		Repositories: NewGormRepositories(c.DB),
+	}
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	v.RegisterValidation("password", validatePasswordPolicy)
+	return v
+}
+
+// currentUserID returns the user ID from the access token stored by the JWTProtected middleware
+func currentUserID(c *fiber.Ctx) uint {
+	return c.Locals("user").(*token.Claims).UserID
+}
@@ -3,14 +3,14 @@ package user
 import (
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/sonyarianto/gobete/internal/systems/db"
 	"github.com/sonyarianto/gobete/internal/systems/response"
 	"github.com/sonyarianto/gobete/internal/systems/utility"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+
+	"context"
 )
 
-func CreateUserHandler(c *fiber.Ctx) error {
+func (s *Service) CreateUserHandler(c *fiber.Ctx) error {
 	var req CreateUserRequest
 
 	req = *c.Locals("body").(*CreateUserRequest) // Get parsed body from context, after middleware parsing
@@ -24,9 +24,12 @@ func CreateUserHandler(c *fiber.Ctx) error {
 		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
 	}
 
-	// Check if user already exists
-	var existing User
-	if err := db.DB.Select("id").Where("email = ?", req.Email).First(&existing).Error; err == nil {
+	// Check if user already exists, deleted users keep their email so it cannot be registered again
+	exists, err := s.Users.EmailExists(c.UserContext(), req.Email, true)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+	if exists {
 		return response.SendErrorResponse(c, fiber.StatusBadRequest, "user_exists")
 	}
 
@@ -37,10 +40,12 @@ func CreateUserHandler(c *fiber.Ctx) error {
 	}
 	req.Password = string(hashedPassword)
 
+	now := s.Clock()
 	user := User{
 		Email:    req.Email,
 		Password: string(hashedPassword),
 	}
+	user.CreatedAt, user.UpdatedAt = now, now
 
 	detail := UserDetail{
 		FirstName: req.FirstName,
@@ -48,15 +53,20 @@ func CreateUserHandler(c *fiber.Ctx) error {
 	}
 
 	// Transaction to create user and user detail
-	err = db.DB.Transaction(func(tx *gorm.DB) error {
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
 		// Create user
-		if err := tx.Create(&user).Error; err != nil {
+		if err := s.Users.Create(ctx, &user); err != nil {
 			return err
 		}
 
 		// Create user detail
 		detail.UserID = user.ID
-		if err := tx.Create(&detail).Error; err != nil {
+		if err := s.Users.CreateDetail(ctx, &detail); err != nil {
+			return err
+		}
+
+		// Every new user gets the default role
+		if err := s.Roles.Assign(ctx, user.ID, RoleUser); err != nil {
 			return err
 		}
 
@@ -66,6 +76,11 @@ func CreateUserHandler(c *fiber.Ctx) error {
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to create user")
 	}
 
+	// Send verification email, the account is created even if sending fails
+	if err := s.sendVerificationEmail(c.UserContext(), user); err != nil {
+		s.Logger.ErrorContext(c.UserContext(), "Failed to send verification email", "target_user_id", user.ID, "error", err)
+	}
+
 	// Return success response with user ID
 	return response.SendSuccessResponse(c, "User created successfully", fiber.Map{
 		"id": user.ID,
@@ -2,29 +2,24 @@ package user
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/sonyarianto/gobete/internal/systems/db"
 	"github.com/sonyarianto/gobete/internal/systems/response"
-	"gorm.io/gorm"
 )
 
-func GetCurrentUserHandler(c *fiber.Ctx) error {
-	userToken := c.Locals("user").(*jwt.Token)
-	claims := userToken.Claims.(jwt.MapClaims)
-	userID := uint(claims["user_id"].(float64)) // JWT stores numbers as float64
+func (s *Service) GetCurrentUserHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
 
 	// Fetch user details from the database
-	var user User
-	if err := db.DB.Select("id, email").Where("id = ?", userID).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
 			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
 		}
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
 	}
 
-	var userDetail UserDetail
-	if err := db.DB.Select("id, first_name, last_name, user_id").Where("user_id = ?", user.ID).First(&userDetail).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	userDetail, err := s.Users.FindDetail(c.UserContext(), user.ID)
+	if err != nil {
+		if err == ErrNotFound {
 			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
 		}
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user details")
@@ -32,9 +27,13 @@ func GetCurrentUserHandler(c *fiber.Ctx) error {
 
 	// Return user details
 	return response.SendSuccessResponse(c, "User details fetched successfully", fiber.Map{
-		"id":         user.ID,
-		"first_name": userDetail.FirstName,
-		"last_name":  userDetail.LastName,
-		"email":      user.Email,
+		"id":             user.ID,
+		"first_name":     userDetail.FirstName,
+		"last_name":      userDetail.LastName,
+		"phone":          userDetail.Phone,
+		"bio":            userDetail.Bio,
+		"avatar_url":     userDetail.AvatarURL,
+		"email":          user.Email,
+		"email_verified": user.EmailVerifiedAt != nil,
 	})
 }
@@ -0,0 +1,166 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Email verification policies, set with the EMAIL_VERIFICATION_POLICY env variable
+const (
+	EmailVerificationOff      = "off"      // Unverified accounts can do everything (default)
+	EmailVerificationRestrict = "restrict" // Unverified accounts can log in, but routes guarded by RequireVerifiedEmail are refused
+	EmailVerificationRequire  = "require"  // Unverified accounts cannot log in
+)
+
+var errVerificationTokenUsed = errors.New("email verification token already used")
+
+// EmailVerificationPolicy returns the configured policy, defaults to EmailVerificationOff
+func (s *Service) EmailVerificationPolicy() string {
+	return s.Config.EmailVerification.Policy
+}
+
+// sendVerificationEmail issues a new verification token for the user, invalidating older ones, and emails it
+func (s *Service) sendVerificationEmail(ctx context.Context, user User) error {
+	rawToken, tokenHash, err := generateOneTimeToken()
+	if err != nil {
+		return err
+	}
+
+	verificationTokenExpire := s.Config.EmailVerification.TokenExpireHours
+
+	now := s.Clock()
+	verificationToken := EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(time.Duration(verificationTokenExpire) * time.Hour),
+		CreatedAt: now,
+	}
+
+	// Only the latest verification token of a user is usable
+	err = s.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.VerificationTokens.DeleteUnused(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.VerificationTokens.Create(ctx, &verificationToken)
+	})
+	if err != nil {
+		return err
+	}
+
+	verifyURL := s.Config.EmailVerification.URL
+
+	return s.Mailer.Send(ctx, mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome! Please confirm your email address.\n\n"+
+			"Open the link below to verify it, it expires in %d hours:\n%s?token=%s\n",
+			verificationTokenExpire, verifyURL, url.QueryEscape(rawToken)),
+	})
+}
+
+// VerifyEmailHandler verifies an email address. The token is read from the "token" query parameter
+// (GET, link from the email) or from the JSON body (POST).
+func (s *Service) VerifyEmailHandler(c *fiber.Ctx) error {
+	rawToken := c.Query("token")
+	if body, ok := c.Locals("body").(*VerifyEmailRequest); ok && rawToken == "" {
+		// Validate input
+		if err := validate.Struct(body); err != nil {
+			if validationErrors, ok := err.(validator.ValidationErrors); ok {
+				errors := utility.FormatValidationErrors(*body, validationErrors)
+				return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+			}
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+		}
+		rawToken = body.Token
+	}
+	if rawToken == "" {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_verification_token")
+	}
+
+	verificationToken, err := s.VerificationTokens.FindValid(c.UserContext(), hashOneTimeToken(rawToken), s.Clock())
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_verification_token")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query verification token")
+	}
+
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		now := s.Clock()
+
+		// Mark token as used, only once
+		used, err := s.VerificationTokens.Use(ctx, verificationToken.ID, now)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errVerificationTokenUsed
+		}
+
+		return s.Users.MarkEmailVerified(ctx, verificationToken.UserID, now)
+	})
+	if err != nil {
+		if err == errVerificationTokenUsed {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_verification_token")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to verify email")
+	}
+
+	return response.SendSuccessResponse(c, "Email verified successfully", nil)
+}
+
+func (s *Service) ResendVerificationEmailHandler(c *fiber.Ctx) error {
+	var req ResendVerificationEmailRequest
+
+	req = *c.Locals("body").(*ResendVerificationEmailRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	// Always return the same message, so the response does not reveal whether the email exists or is verified
+	const message = "If the email is registered and not verified yet, a verification link has been sent"
+
+	user, err := s.Users.FindByEmail(c.UserContext(), req.Email)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendSuccessResponse(c, message, nil)
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+	if user.EmailVerifiedAt != nil {
+		return response.SendSuccessResponse(c, message, nil)
+	}
+
+	resendCooldown := s.Config.EmailVerification.ResendCooldownSeconds
+
+	// Silently skip if a token was issued for this user recently
+	recent, err := s.VerificationTokens.CountCreatedAfter(c.UserContext(), user.ID, s.Clock().Add(-time.Duration(resendCooldown)*time.Second))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query verification tokens")
+	}
+	if recent > 0 {
+		return response.SendSuccessResponse(c, message, nil)
+	}
+
+	if err := s.sendVerificationEmail(c.UserContext(), *user); err != nil {
+		// Do not reveal delivery problems to the caller
+		s.Logger.ErrorContext(c.UserContext(), "Failed to send verification email", "target_user_id", user.ID, "error", err)
+	}
+
+	return response.SendSuccessResponse(c, message, nil)
+}
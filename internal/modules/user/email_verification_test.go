@@ -0,0 +1,107 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newVerificationTestApp serves registration and email verification on top of newTestApp
+func newVerificationTestApp(s *Service) *fiber.App {
+	app := newTestApp(s)
+	app.Post("/users", parseBody[CreateUserRequest](), s.CreateUserHandler)
+	app.Get("/verify-email", s.VerifyEmailHandler)
+	app.Post("/verify-email", parseBody[VerifyEmailRequest](), s.VerifyEmailHandler)
+	app.Post("/verify-email/resend", parseBody[ResendVerificationEmailRequest](), s.ResendVerificationEmailHandler)
+	return app
+}
+
+func TestRegistrationEmailVerification(t *testing.T) {
+	s := newTestService(t)
+	s.Config.EmailVerification.Policy = EmailVerificationRequire
+	mails := s.Mailer.(*mailer.MemoryMailer)
+	app := newVerificationTestApp(s)
+
+	res := do(t, app, http.MethodPost, "/users", CreateUserRequest{Email: "jane@example.com", Password: testPassword, FirstName: "Jane", LastName: "Doe"}, nil)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("register = %d (%s), want 200", res.Status, res.Code)
+	}
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusForbidden || res.Code != "email_not_verified" {
+		t.Fatalf("login before verification = %d (%s), want 403 email_not_verified", res.Status, res.Code)
+	}
+	messages := mails.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "jane@example.com" {
+		t.Fatalf("emails after registration = %+v, want one to jane@example.com", messages)
+	}
+	firstToken := linkToken(t, messages[0].Body)
+
+	// Resending within the cooldown sends nothing
+	resend := ResendVerificationEmailRequest{Email: "jane@example.com"}
+	if res := do(t, app, http.MethodPost, "/verify-email/resend", resend, nil); res.Status != fiber.StatusOK {
+		t.Fatalf("resend = %d (%s), want 200", res.Status, res.Code)
+	}
+	if got := len(mails.Messages()); got != 1 {
+		t.Fatalf("%d emails after resending within the cooldown, want 1", got)
+	}
+
+	// After the cooldown a new link replaces the first one
+	registeredAt := s.Clock()
+	s.Clock = func() time.Time {
+		return registeredAt.Add(time.Duration(s.Config.EmailVerification.ResendCooldownSeconds+1) * time.Second)
+	}
+	do(t, app, http.MethodPost, "/verify-email/resend", resend, nil)
+	messages = mails.Messages()
+	if len(messages) != 2 {
+		t.Fatalf("%d emails after resending, want 2", len(messages))
+	}
+	secondToken := linkToken(t, messages[1].Body)
+
+	if res := do(t, app, http.MethodGet, "/verify-email?token="+url.QueryEscape(firstToken), nil, nil); res.Status != fiber.StatusBadRequest || res.Code != "invalid_verification_token" {
+		t.Errorf("verify with the replaced token = %d (%s), want 400 invalid_verification_token", res.Status, res.Code)
+	}
+	if res := do(t, app, http.MethodPost, "/verify-email", VerifyEmailRequest{Token: secondToken}, nil); res.Status != fiber.StatusOK {
+		t.Fatalf("verify = %d (%s), want 200", res.Status, res.Code)
+	}
+	if res := do(t, app, http.MethodGet, "/verify-email?token="+url.QueryEscape(secondToken), nil, nil); res.Status != fiber.StatusBadRequest || res.Code != "invalid_verification_token" {
+		t.Errorf("verify with a used token = %d (%s), want 400 invalid_verification_token", res.Status, res.Code)
+	}
+
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusOK {
+		t.Errorf("login after verification = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	// Verified and unknown emails get the same answer, without an email
+	for _, email := range []string{"jane@example.com", "nobody@example.com"} {
+		if res := do(t, app, http.MethodPost, "/verify-email/resend", ResendVerificationEmailRequest{Email: email}, nil); res.Status != fiber.StatusOK {
+			t.Errorf("resend to %s = %d (%s), want 200", email, res.Status, res.Code)
+		}
+	}
+	if got := len(mails.Messages()); got != 2 {
+		t.Errorf("%d emails after resending to verified and unknown emails, want 2", got)
+	}
+}
+
+func TestVerifyEmailExpiredToken(t *testing.T) {
+	s := newTestService(t)
+	mails := s.Mailer.(*mailer.MemoryMailer)
+	app := newVerificationTestApp(s)
+
+	do(t, app, http.MethodPost, "/users", CreateUserRequest{Email: "jane@example.com", Password: testPassword, FirstName: "Jane", LastName: "Doe"}, nil)
+	messages := mails.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("%d emails after registration, want 1", len(messages))
+	}
+
+	registeredAt := s.Clock()
+	s.Clock = func() time.Time {
+		return registeredAt.Add(time.Duration(s.Config.EmailVerification.TokenExpireHours)*time.Hour + time.Second)
+	}
+	res := do(t, app, http.MethodPost, "/verify-email", VerifyEmailRequest{Token: linkToken(t, messages[0].Body)}, nil)
+	if res.Status != fiber.StatusBadRequest || res.Code != "invalid_verification_token" {
+		t.Errorf("verify with an expired token = %d (%s), want 400 invalid_verification_token", res.Status, res.Code)
+	}
+}
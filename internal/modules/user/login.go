@@ -3,38 +3,14 @@ package user
 import (
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"github.com/sonyarianto/gobete/internal/systems/db"
 	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/token"
 	"github.com/sonyarianto/gobete/internal/systems/utility"
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
-
-	"os"
-	"strconv"
-	"time"
 )
 
-// GenerateAccessToken creates a JWT token with the given parameters.
-func GenerateAccessToken(userID uint, email string, secret []byte, expireMinutes int) (string, *jwt.Token, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"exp":     time.Now().Add(time.Duration(expireMinutes) * time.Minute).Unix(),
-		"iat":     time.Now().Unix(),
-		"jti":     uuid.NewString(),
-	})
-
-	signedString, err := token.SignedString(secret)
-	if err != nil {
-		return "", nil, err
-	}
-
-	return signedString, token, nil
-}
-
-func LoginUserHandler(c *fiber.Ctx) error {
+func (s *Service) LoginUserHandler(c *fiber.Ctx) error {
 	var req LoginRequest
 
 	req = *c.Locals("body").(*LoginRequest) // Get parsed body from context, after middleware parsing
@@ -48,135 +24,134 @@ func LoginUserHandler(c *fiber.Ctx) error {
 		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
 	}
 
+	// Refuse locked emails and client IPs before checking the password
+	lockedFor, err := s.loginLockedFor(c.UserContext(), emailThrottleKey(req.Email), ipThrottleKey(c.IP()))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query login attempts")
+	}
+	if lockedFor > 0 {
+		return s.sendLoginLockedResponse(c, lockedFor)
+	}
+
 	// Find user by email
-	var user User
-	if err := db.DB.Select("id, password, email").Where("email = ?", req.Email).First(&user).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_credentials")
+	user, err := s.Users.FindByEmail(c.UserContext(), req.Email)
+	if err != nil {
+		if err != ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
 		}
-		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+		compareDummyPassword(req.Password) // Unknown emails take as long as wrong passwords
+		user = &User{}
 	}
 
 	// Compare password with hashed password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+	if user.ID == 0 || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+		if err := s.recordLoginFailures(c.UserContext(), req.Email, c.IP()); err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to record login attempt")
+		}
 		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_credentials")
 	}
 
+	// Refuse unverified accounts if required by the email verification policy
+	if s.EmailVerificationPolicy() == EmailVerificationRequire && user.EmailVerifiedAt == nil {
+		return response.SendErrorResponse(c, fiber.StatusForbidden, "email_not_verified")
+	}
+
+	// Second step of the login if the user has enabled two-factor authentication. The failures are
+	// only forgotten once the code is accepted, so wrong codes keep counting toward the lockout.
+	mfaEnabled, err := s.isMFAEnabled(c.UserContext(), user.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+	if mfaEnabled {
+		return s.sendMFAChallenge(c, *user)
+	}
+
+	if err := s.resetLoginFailures(c.UserContext(), req.Email); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to reset login attempts")
+	}
+
+	return s.completeLogin(c, *user, req.DeviceLabel)
+}
+
+// sendMFAChallenge responds with the MFA token to exchange on /v1/login/mfa, instead of the access token
+func (s *Service) sendMFAChallenge(c *fiber.Ctx, user User) error {
+	mfaTokenString, mfaClaims, err := s.Tokens.IssueMFAToken(token.Claims{UserID: user.ID, Email: user.Email})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate MFA token")
+	}
+	return response.SendSuccessResponse(c, "MFA code required", fiber.Map{
+		"mfa_required":   true,
+		"mfa_token":      mfaTokenString,
+		"mfa_expires_at": mfaClaims.ExpiresAt.Time,
+	})
+}
+
+// completeLogin issues the access and refresh tokens of an authenticated user and sends the login response
+func (s *Service) completeLogin(c *fiber.Ctx, user User, deviceLabel string) error {
 	// Will return id, first_name, last_name and email
-	var userDetail UserDetail
-	if err := db.DB.Select("id, first_name, last_name, user_id").Where("user_id = ?", user.ID).First(&userDetail).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
+	userDetail, err := s.Users.FindDetail(c.UserContext(), user.ID)
+	if err != nil {
+		if err == ErrNotFound {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "record_not_found")
 		}
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user details")
 	}
 
-	// Get env variable for access token expiry
-	accessTokenExpireMinutes := os.Getenv("ACCESS_TOKEN_EXPIRE_MINUTES")
-
-	// Convert to int, default to 15 if not set or invalid
-	var accessTokenExpire int = 15
-	if accessTokenExpireMinutes != "" {
-		if v, err := strconv.Atoi(accessTokenExpireMinutes); err == nil {
-			accessTokenExpire = v
-		}
+	// Fetch roles and permissions to embed in the access token
+	roles, permissions, err := s.GetUserRolesAndPermissions(c.UserContext(), user.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user roles")
 	}
 
 	// Generate JWT access token (short-lived)
-	accessTokenString, _, err := GenerateAccessToken(user.ID, user.Email, jwtSecret, accessTokenExpire)
+	accessTokenString, _, err := s.Tokens.IssueAccessToken(token.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerifiedAt != nil,
+	})
 	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate access token")
 	}
 
-	// Get env variable for refresh token expiry
-	refreshTokenExpireDays := os.Getenv("REFRESH_TOKEN_EXPIRE_DAYS")
-
-	// Convert to int, default to 7 if not set or invalid
-	var refreshTokenExpire int = 7
-	if refreshTokenExpireDays != "" {
-		if v, err := strconv.Atoi(refreshTokenExpireDays); err == nil {
-			refreshTokenExpire = v
-		}
-	}
-
-	// Convert days to minutes for token expiry
-	refreshTokenExpireMinutes := refreshTokenExpire * 24 * 60
-
 	// Generate JWT refresh token (long-lived)
-	refreshTokenString, refreshToken, err := GenerateAccessToken(user.ID, user.Email, jwtSecret, refreshTokenExpireMinutes)
+	refreshTokenString, refreshClaims, err := s.Tokens.IssueRefreshToken(token.Claims{UserID: user.ID, Email: user.Email})
 	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate refresh token")
 	}
 
-	// Get env variable for session mode
-	sessionMode := os.Getenv("SESSION_MODE")
-
 	// If session mode is "jwt_server_stateful", store JTI in UserSession table
-	if sessionMode == "jwt_server_stateful" {
-		// Get JTI from token claims and store in UserSession
-		claims := refreshToken.Claims.(jwt.MapClaims)
-
-		jtiVal, ok := claims["jti"]
-		if !ok {
-			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to get JTI from refresh token claims")
-		}
-		jti, ok := jtiVal.(string)
-		if !ok {
-			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "JTI is not a string")
-		}
-
-		issuedAt, ok := claims["iat"].(int64)
-		if !ok {
-			// fallback for float64 (if token was generated elsewhere)
-			if f, ok := claims["iat"].(float64); ok {
-				issuedAt = int64(f)
-			} else {
-				return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Invalid iat type")
-			}
-		}
-
-		expiresAt, ok := claims["exp"].(int64)
-		if !ok {
-			if f, ok := claims["exp"].(float64); ok {
-				expiresAt = int64(f)
-			} else {
-				return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Invalid exp type")
-			}
-		}
-
-		// Convert int64 to time.Time
-		issuedAtTime := time.Unix(issuedAt, 0)
-		expiresAtTime := time.Unix(expiresAt, 0)
-
+	if s.Config.Session.Stateful() {
 		session := UserSession{
 			UserID:     user.ID,
-			JTI:        jti, // JTI of the refresh token
-			CreatedAt:  issuedAtTime,
-			ExpiresAt:  expiresAtTime,
-			LastSeenAt: issuedAtTime,
+			JTI:        refreshClaims.ID, // JTI of the refresh token
+			FamilyID:   uuid.NewString(), // New login starts a new rotation family
+			Label:      deviceLabel,
+			UserAgent:  c.Get(fiber.HeaderUserAgent),
+			IPAddress:  c.IP(),
+			CreatedAt:  refreshClaims.IssuedAt.Time,
+			ExpiresAt:  refreshClaims.ExpiresAt.Time,
+			LastSeenAt: refreshClaims.IssuedAt.Time,
 		}
-		if err := db.DB.Create(&session).Error; err != nil {
+		if err := s.Sessions.Create(c.UserContext(), &session); err != nil {
 			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to create user session")
 		}
 	}
 
-	// Set refresh token as HttpOnly cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshTokenString,
-		HTTPOnly: true,
-		SameSite: fiber.CookieSameSiteLaxMode,
-		Expires:  time.Now().Add(time.Duration(refreshTokenExpire) * 24 * time.Hour),
-		Secure:   os.Getenv("ENV") == "production", // Only send cookie over HTTPS in production
-		Path:     "/",                              // Cookie valid for all paths
-	})
-
 	// Return success response with access token
-	return response.SendSuccessResponse(c, "User logged in successfully", fiber.Map{
-		"id":           user.ID,
-		"first_name":   userDetail.FirstName,
-		"last_name":    userDetail.LastName,
-		"email":        user.Email,
-		"access_token": accessTokenString,
-	})
+	data := fiber.Map{
+		"id":             user.ID,
+		"first_name":     userDetail.FirstName,
+		"last_name":      userDetail.LastName,
+		"email":          user.Email,
+		"roles":          roles,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"access_token":   accessTokenString,
+	}
+
+	// Hand out the refresh token as HttpOnly cookie or in the response body, depending on the client type
+	s.sendRefreshToken(c, data, refreshTokenString, refreshClaims.ExpiresAt.Time)
+
+	return response.SendSuccessResponse(c, "User logged in successfully", data)
 }
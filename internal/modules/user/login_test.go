@@ -0,0 +1,271 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/container"
+	"github.com/sonyarianto/gobete/internal/systems/health"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+	"golang.org/x/crypto/bcrypt"
+
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPassword = "Secret123!"
+
+// newTestService creates the user service on in-memory repositories, in stateful session mode and
+// with a fixed clock
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.Session.Mode = config.SessionModeStateful
+
+	keys, err := signing.NewKeyManagerFromConfig(cfg.JWT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deps := &container.Container{
+		Config:      cfg,
+		Keys:        keys,
+		Tokens:      token.NewService(keys, cfg.JWT),
+		Revocations: revocation.NewMemoryStore(),
+		Mailer:      mailer.NewMemoryMailer(),
+		Clock:       func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) },
+		Logger:      slog.New(slog.DiscardHandler),
+		Health:      health.NewRegistry(),
+	}
+	deps.Tokens.Now = func() time.Time { return deps.Clock() }
+
+	return &Service{Container: deps, Repositories: NewMemoryRepositories()}
+}
+
+// addTestUser stores a user with the test password and the default role
+func addTestUser(t *testing.T, s *Service, email string, verified bool) User {
+	t.Helper()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := User{Email: email, Password: string(hashedPassword)}
+	if verified {
+		verifiedAt := s.Clock()
+		user.EmailVerifiedAt = &verifiedAt
+	}
+	if err := s.Users.Create(t.Context(), &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Users.CreateDetail(t.Context(), &UserDetail{UserID: user.ID, FirstName: "Jane", LastName: "Doe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Roles.Assign(t.Context(), user.ID, RoleUser); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// parseBody stores the parsed JSON body for the handler, like middleware.BodyParser
+func parseBody[T any]() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req := new(T)
+		if err := c.BodyParser(req); err != nil {
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+		c.Locals("body", req)
+		return c.Next()
+	}
+}
+
+// newTestApp serves the login, MFA login, refresh and current user endpoints of the service
+func newTestApp(s *Service) *fiber.App {
+	app := fiber.New()
+	app.Post("/login", parseBody[LoginRequest](), s.LoginUserHandler)
+	app.Post("/login/mfa", parseBody[LoginMFARequest](), s.LoginMFAHandler)
+	app.Post("/refresh", s.RefreshTokenHandler)
+	app.Get("/me", authenticate(s), s.GetCurrentUserHandler)
+	return app
+}
+
+// authenticate stores the claims of a valid, not revoked access token, like middleware.JWTProtected
+func authenticate(s *Service) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := s.Tokens.ParseAccessToken(strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "))
+		if err != nil {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized")
+		}
+		if revoked, err := revocation.IsRevoked(c.UserContext(), s.Revocations, claims); err != nil || revoked {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized")
+		}
+		c.Locals("user", claims)
+		return c.Next()
+	}
+}
+
+// bearer is the Authorization header of an access token
+func bearer(accessToken string) map[string]string {
+	return map[string]string{fiber.HeaderAuthorization: "Bearer " + accessToken}
+}
+
+type testResponse struct {
+	Status int
+	Header http.Header
+	Code   string         `json:"code"`
+	Data   map[string]any `json:"data"`
+}
+
+// do sends a request as a mobile client, so refresh tokens travel in the body and headers
+func do(t *testing.T, app *fiber.App, method, path string, body any, headers map[string]string) testResponse {
+	t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set("X-Client-Type", ClientTypeMobile)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	result := testResponse{Status: res.StatusCode, Header: res.Header}
+	if err := json.NewDecoder(res.Body).Decode(&result); err != nil {
+		t.Fatalf("%s %s: decoding response: %v", method, path, err)
+	}
+	return result
+}
+
+func login(t *testing.T, app *fiber.App, email, password string) testResponse {
+	t.Helper()
+	return do(t, app, http.MethodPost, "/login", LoginRequest{Email: email, Password: password}, nil)
+}
+
+func TestLoginRefreshAndCurrentUser(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	user := addTestUser(t, s, "jane@example.com", true)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login status = %d (%s), want 200", res.Status, res.Code)
+	}
+	accessToken, _ := res.Data["access_token"].(string)
+	refreshToken, _ := res.Data["refresh_token"].(string)
+	if accessToken == "" || refreshToken == "" {
+		t.Fatalf("login data = %v, want access and refresh tokens", res.Data)
+	}
+
+	sessions, err := s.Sessions.ListActive(t.Context(), user.ID, s.Clock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("%d active sessions after login, want 1", len(sessions))
+	}
+
+	res = do(t, app, http.MethodGet, "/me", nil, map[string]string{fiber.HeaderAuthorization: "Bearer " + accessToken})
+	if res.Status != fiber.StatusOK || res.Data["email"] != "jane@example.com" || res.Data["first_name"] != "Jane" {
+		t.Fatalf("current user = %d %v, want jane@example.com", res.Status, res.Data)
+	}
+
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("refresh status = %d (%s), want 200", res.Status, res.Code)
+	}
+	if rotated, _ := res.Data["refresh_token"].(string); rotated == "" || rotated == refreshToken {
+		t.Fatalf("refresh data = %v, want a new refresh token", res.Data)
+	}
+
+	// The rotated refresh token is refused and revokes its whole family
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusUnauthorized || res.Code != "refresh_token_reused" {
+		t.Fatalf("reused refresh = %d (%s), want 401 refresh_token_reused", res.Status, res.Code)
+	}
+	sessions, err = s.Sessions.ListActive(t.Context(), user.ID, s.Clock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d active sessions after refresh token reuse, want 0", len(sessions))
+	}
+	events := s.SecurityEvents.(*MemorySecurityEventRepository).Events()
+	if len(events) != 1 || events[0].Type != SecurityEventRefreshTokenReuse {
+		t.Errorf("security events = %+v, want one refresh token reuse", events)
+	}
+}
+
+func TestLoginInvalidCredentials(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	for _, tt := range []struct{ email, password string }{
+		{"jane@example.com", "Wrong123!"},
+		{"nobody@example.com", testPassword},
+	} {
+		res := login(t, app, tt.email, tt.password)
+		if res.Status != fiber.StatusUnauthorized || res.Code != "invalid_credentials" {
+			t.Errorf("login %s = %d (%s), want 401 invalid_credentials", tt.email, res.Status, res.Code)
+		}
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	for range s.Config.Login.MaxAttempts {
+		login(t, app, "jane@example.com", "Wrong123!")
+	}
+
+	// Locked, even with the right password
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusTooManyRequests {
+		t.Fatalf("login while locked = %d (%s), want 429", res.Status, res.Code)
+	}
+
+	// The lockout ends with the clock
+	lockedAt := s.Clock()
+	s.Clock = func() time.Time { return lockedAt.Add(time.Duration(s.Config.Login.LockoutSeconds+1) * time.Second) }
+	res = login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login after lockout = %d (%s), want 200", res.Status, res.Code)
+	}
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	s := newTestService(t)
+	s.Config.EmailVerification.Policy = EmailVerificationRequire
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", false)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusForbidden || res.Code != "email_not_verified" {
+		t.Errorf("login = %d (%s), want 403 email_not_verified", res.Status, res.Code)
+	}
+}
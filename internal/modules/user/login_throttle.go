@@ -0,0 +1,157 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Login lockout responses, set with the LOGIN_LOCKOUT_RESPONSE env variable
+const (
+	LoginLockoutResponseLocked  = "locked"  // 429 too_many_login_attempts with a Retry-After header (default)
+	LoginLockoutResponseGeneric = "generic" // 401 invalid_credentials, same as a wrong password
+)
+
+// dummyPasswordHash is compared for unknown emails, computed at startup so the first request is not slower
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password for timing"), bcrypt.DefaultCost)
+
+// loginThrottleConfig is the login configuration as durations
+type loginThrottleConfig struct {
+	MaxAttempts      int           // LOGIN_MAX_ATTEMPTS, failures per email before a lockout
+	MaxAttemptsPerIP int           // LOGIN_MAX_ATTEMPTS_PER_IP, failures per client IP before a lockout
+	Lockout          time.Duration // LOGIN_LOCKOUT_SECONDS, first lockout, doubled on every further failure
+	MaxLockout       time.Duration // LOGIN_LOCKOUT_MAX_SECONDS
+	Window           time.Duration // LOGIN_ATTEMPT_WINDOW_MINUTES, quiet time after which failures are forgotten
+}
+
+func (s *Service) getLoginThrottleConfig() loginThrottleConfig {
+	return loginThrottleConfig{
+		MaxAttempts:      s.Config.Login.MaxAttempts,
+		MaxAttemptsPerIP: s.Config.Login.MaxAttemptsPerIP,
+		Lockout:          time.Duration(s.Config.Login.LockoutSeconds) * time.Second,
+		MaxLockout:       time.Duration(s.Config.Login.LockoutMaxSeconds) * time.Second,
+		Window:           time.Duration(s.Config.Login.AttemptWindowMinutes) * time.Minute,
+	}
+}
+
+// lockoutDuration grows exponentially with the failures over the limit
+func (cfg loginThrottleConfig) lockoutDuration(overLimit int) time.Duration {
+	d := float64(cfg.Lockout) * math.Pow(2, float64(overLimit))
+	if d > float64(cfg.MaxLockout) {
+		return cfg.MaxLockout
+	}
+	return time.Duration(d)
+}
+
+// emailThrottleKey is tracked for unknown emails as well, so a lockout does not reveal whether the email exists
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginLockedFor returns how long logins are still refused for any of the keys, zero if they are allowed
+func (s *Service) loginLockedFor(ctx context.Context, keys ...string) (time.Duration, error) {
+	throttles, err := s.LoginThrottles.FindLocked(ctx, keys, s.Clock())
+	if err != nil {
+		return 0, err
+	}
+
+	var lockedFor time.Duration
+	for _, throttle := range throttles {
+		lockedFor = max(lockedFor, throttle.LockedUntil.Sub(s.Clock()))
+	}
+	return lockedFor, nil
+}
+
+// recordLoginFailure counts a failed login for the key and locks it once the limit is reached
+func (s *Service) recordLoginFailure(ctx context.Context, cfg loginThrottleConfig, key string, maxAttempts int) error {
+	return s.Transaction(ctx, func(ctx context.Context) error {
+		throttle, err := s.LoginThrottles.FindForUpdate(ctx, key)
+		if err == ErrNotFound {
+			throttle = &LoginThrottle{ThrottleKey: key}
+		} else if err != nil {
+			return err
+		}
+
+		now := s.Clock()
+
+		// Forget old failures after a quiet window, counted from the end of the last lockout
+		lastActivity := throttle.LastFailureAt
+		if throttle.LockedUntil != nil && throttle.LockedUntil.After(lastActivity) {
+			lastActivity = *throttle.LockedUntil
+		}
+		if now.Sub(lastActivity) > cfg.Window {
+			throttle.Failures = 0
+		}
+
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		if throttle.Failures >= maxAttempts {
+			lockedUntil := now.Add(cfg.lockoutDuration(throttle.Failures - maxAttempts))
+			throttle.LockedUntil = &lockedUntil
+		}
+
+		return s.LoginThrottles.Save(ctx, throttle)
+	})
+}
+
+// recordLoginFailures counts a failed login for the email and the client IP
+func (s *Service) recordLoginFailures(ctx context.Context, email, ip string) error {
+	cfg := s.getLoginThrottleConfig()
+	if err := s.recordLoginFailure(ctx, cfg, emailThrottleKey(email), cfg.MaxAttempts); err != nil {
+		return err
+	}
+	return s.recordLoginFailure(ctx, cfg, ipThrottleKey(ip), cfg.MaxAttemptsPerIP)
+}
+
+// resetLoginFailures forgets the failures of an email, the client IP keeps its count so one
+// valid account cannot be used to reset the counter of an IP trying many accounts
+func (s *Service) resetLoginFailures(ctx context.Context, email string) error {
+	return s.LoginThrottles.Delete(ctx, emailThrottleKey(email))
+}
+
+// compareDummyPassword spends the same time as a real password check, for unknown emails
+func compareDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(password))
+}
+
+// sendLoginLockedResponse refuses a locked login, as configured with LOGIN_LOCKOUT_RESPONSE
+func (s *Service) sendLoginLockedResponse(c *fiber.Ctx, lockedFor time.Duration) error {
+	if s.Config.Login.LockoutResponse == LoginLockoutResponseGeneric {
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_credentials")
+	}
+
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	return response.SendErrorResponse(c, fiber.StatusTooManyRequests, "too_many_login_attempts")
+}
+
+// UnlockUserHandler lets an admin clear the login lockout of a user
+func (s *Service) UnlockUserHandler(c *fiber.Ctx) error {
+	userID, err := c.ParamsInt("id")
+	if err != nil || userID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_user_id")
+	}
+
+	user, err := s.Users.FindByID(c.UserContext(), uint(userID))
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "user_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	if err := s.resetLoginFailures(c.UserContext(), user.Email); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to unlock user")
+	}
+
+	return response.SendSuccessResponse(c, "User unlocked successfully", nil)
+}
@@ -0,0 +1,142 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	cfg := loginThrottleConfig{Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+
+	tests := []struct {
+		overLimit int
+		want      time.Duration
+	}{
+		{0, time.Minute},
+		{1, 2 * time.Minute},
+		{3, 8 * time.Minute},
+		{4, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := cfg.lockoutDuration(tt.overLimit); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.overLimit, got, tt.want)
+		}
+	}
+}
+
+// failLogins sends n logins with a wrong password
+func failLogins(t *testing.T, app *fiber.App, email string, n int) {
+	t.Helper()
+	for range n {
+		login(t, app, email, "Wrong123!")
+	}
+}
+
+func TestLoginLockoutBacksOff(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+	lockout := s.Config.Login.LockoutSeconds
+
+	for _, email := range []string{"jane@example.com", "nobody@example.com"} {
+		start := s.Clock()
+
+		// Unknown emails lock the same way, so a lockout does not reveal accounts
+		failLogins(t, app, email, s.Config.Login.MaxAttempts)
+		res := login(t, app, email, testPassword)
+		if res.Status != fiber.StatusTooManyRequests || res.Code != "too_many_login_attempts" || res.Header.Get(fiber.HeaderRetryAfter) != strconv.Itoa(lockout) {
+			t.Fatalf("%s: login while locked = %d (%s) Retry-After %q, want 429 too_many_login_attempts after %d", email, res.Status, res.Code, res.Header.Get(fiber.HeaderRetryAfter), lockout)
+		}
+
+		// Another failure after the lockout locks for twice as long
+		s.Clock = func() time.Time { return start.Add(time.Duration(lockout+1) * time.Second) }
+		failLogins(t, app, email, 1)
+		res = login(t, app, email, testPassword)
+		if res.Status != fiber.StatusTooManyRequests || res.Header.Get(fiber.HeaderRetryAfter) != strconv.Itoa(2*lockout) {
+			t.Errorf("%s: login after a further failure = %d Retry-After %q, want 429 after %d", email, res.Status, res.Header.Get(fiber.HeaderRetryAfter), 2*lockout)
+		}
+	}
+}
+
+func TestLoginFailuresAreForgotten(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+	start := s.Clock()
+
+	// A successful login resets the count of the email
+	failLogins(t, app, "jane@example.com", s.Config.Login.MaxAttempts-1)
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusOK {
+		t.Fatalf("login = %d (%s), want 200", res.Status, res.Code)
+	}
+	failLogins(t, app, "jane@example.com", s.Config.Login.MaxAttempts-1)
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusOK {
+		t.Fatalf("login after a reset count = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	// So does a quiet window
+	failLogins(t, app, "jane@example.com", s.Config.Login.MaxAttempts-1)
+	s.Clock = func() time.Time {
+		return start.Add(time.Duration(s.Config.Login.AttemptWindowMinutes)*time.Minute + time.Second)
+	}
+	failLogins(t, app, "jane@example.com", 1)
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusOK {
+		t.Errorf("login after a quiet window = %d (%s), want 200", res.Status, res.Code)
+	}
+}
+
+func TestLoginLockoutPerIP(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Login.MaxAttemptsPerIP = 3
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	// One failure on each of many emails locks the client IP
+	for i := range s.Config.Login.MaxAttemptsPerIP {
+		failLogins(t, app, fmt.Sprintf("user%d@example.com", i), 1)
+	}
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusTooManyRequests {
+		t.Errorf("login from a locked IP = %d (%s), want 429", res.Status, res.Code)
+	}
+}
+
+func TestLoginLockoutGenericResponse(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Login.LockoutResponse = LoginLockoutResponseGeneric
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	failLogins(t, app, "jane@example.com", s.Config.Login.MaxAttempts)
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusUnauthorized || res.Code != "invalid_credentials" || res.Header.Get(fiber.HeaderRetryAfter) != "" {
+		t.Errorf("login while locked = %d (%s) Retry-After %q, want 401 invalid_credentials without Retry-After", res.Status, res.Code, res.Header.Get(fiber.HeaderRetryAfter))
+	}
+}
+
+func TestUnlockUser(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	app.Post("/users/:id/unlock", s.UnlockUserHandler)
+	user := addTestUser(t, s, "jane@example.com", true)
+
+	failLogins(t, app, "jane@example.com", s.Config.Login.MaxAttempts)
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusTooManyRequests {
+		t.Fatalf("login while locked = %d (%s), want 429", res.Status, res.Code)
+	}
+
+	if res := do(t, app, http.MethodPost, "/users/999/unlock", nil, nil); res.Status != fiber.StatusNotFound || res.Code != "user_not_found" {
+		t.Errorf("unlock an unknown user = %d (%s), want 404 user_not_found", res.Status, res.Code)
+	}
+	if res := do(t, app, http.MethodPost, fmt.Sprintf("/users/%d/unlock", user.ID), nil, nil); res.Status != fiber.StatusOK {
+		t.Fatalf("unlock = %d (%s), want 200", res.Status, res.Code)
+	}
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusOK {
+		t.Errorf("login after unlock = %d (%s), want 200", res.Status, res.Code)
+	}
+}
@@ -0,0 +1,362 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+	"github.com/sonyarianto/gobete/internal/systems/totp"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+)
+
+// Number of recovery codes generated when MFA is enabled
+const (
+	recoveryCodeCount = 10
+)
+
+var (
+	recoveryCodeEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+	errInvalidMFACode    = errors.New("invalid mfa code")
+)
+
+// isMFAEnabled reports whether the user has confirmed a TOTP second factor
+func (s *Service) isMFAEnabled(ctx context.Context, userID uint) (bool, error) {
+	_, err := s.MFA.FindEnabled(ctx, userID)
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// mfaIssuer is the issuer shown by authenticator apps, set with MFA_ISSUER
+func (s *Service) mfaIssuer() string {
+	return s.Config.MFA.Issuer
+}
+
+// normalizeRecoveryCode makes recovery codes case, space and dash insensitive
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// generateRecoveryCodes replaces the recovery codes of the user and returns the new codes in plain text,
+// they are only stored hashed
+func (s *Service) generateRecoveryCodes(ctx context.Context, userID uint) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	codeHashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10) // 80 bits
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(recoveryCodeEncoding.EncodeToString(b)) // 16 characters
+		codes[i] = code[:8] + "-" + code[8:]
+		codeHashes[i] = hashOneTimeToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.MFA.ReplaceRecoveryCodes(ctx, userID, codeHashes, s.Clock()); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifyMFACode checks a TOTP code or an unused recovery code of a user with enabled MFA.
+// Both are single use: the time step of a TOTP code must be newer than the last accepted one.
+func (s *Service) verifyMFACode(ctx context.Context, mfa *UserMFA, code string) (bool, error) {
+	if step, ok := totp.Validate(mfa.Secret, code, s.Clock()); ok {
+		return s.MFA.UseStep(ctx, mfa.ID, step)
+	}
+
+	return s.MFA.UseRecoveryCode(ctx, mfa.UserID, hashOneTimeToken(normalizeRecoveryCode(code)), s.Clock())
+}
+
+// SetupMFAHandler starts the MFA enrollment with a new secret. It is not required at login
+// until it is confirmed with EnableMFAHandler.
+func (s *Service) SetupMFAHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	mfaEnabled, err := s.isMFAEnabled(c.UserContext(), user.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+	if mfaEnabled {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "mfa_already_enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate MFA secret")
+	}
+
+	// Replace a pending setup, if any
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		if err := s.MFA.Delete(ctx, user.ID); err != nil {
+			return err
+		}
+		now := s.Clock()
+		return s.MFA.Create(ctx, &UserMFA{UserID: user.ID, Secret: secret, CreatedAt: now, UpdatedAt: now})
+	})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to save MFA secret")
+	}
+
+	return response.SendSuccessResponse(c, "MFA setup started, confirm it with a code from your authenticator app", fiber.Map{
+		"secret":           secret,
+		"provisioning_uri": totp.ProvisioningURI(secret, s.mfaIssuer(), user.Email), // Render as QR code
+	})
+}
+
+// EnableMFAHandler confirms the MFA setup with a code and returns the recovery codes
+func (s *Service) EnableMFAHandler(c *fiber.Ctx) error {
+	var req MFACodeRequest
+
+	req = *c.Locals("body").(*MFACodeRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	userID := currentUserID(c)
+
+	mfa, err := s.MFA.Find(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "mfa_setup_required")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+	if mfa.EnabledAt != nil {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "mfa_already_enabled")
+	}
+
+	step, ok := totp.Validate(mfa.Secret, req.Code, s.Clock())
+	if !ok {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_mfa_code")
+	}
+
+	var recoveryCodes []string
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		if err := s.MFA.Enable(ctx, mfa.ID, s.Clock(), step); err != nil {
+			return err
+		}
+
+		var err error
+		recoveryCodes, err = s.generateRecoveryCodes(ctx, userID)
+		return err
+	})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to enable MFA")
+	}
+
+	return response.SendSuccessResponse(c, "MFA enabled successfully, store the recovery codes in a safe place", fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableMFAHandler removes the second factor, it requires the password and a TOTP or recovery code
+func (s *Service) DisableMFAHandler(c *fiber.Ctx) error {
+	var req DisableMFARequest
+
+	req = *c.Locals("body").(*DisableMFARequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	userID := currentUserID(c)
+
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Verify current password, respond with 400 (not 401) so clients don't try to refresh the token
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_current_password")
+	}
+
+	mfa, err := s.MFA.FindEnabled(c.UserContext(), user.ID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "mfa_not_enabled")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		ok, err := s.verifyMFACode(ctx, mfa, req.Code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidMFACode
+		}
+
+		return s.MFA.Delete(ctx, user.ID)
+	})
+	if err != nil {
+		if err == errInvalidMFACode {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_mfa_code")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to disable MFA")
+	}
+
+	return response.SendSuccessResponse(c, "MFA disabled successfully", nil)
+}
+
+// RegenerateRecoveryCodesHandler replaces the recovery codes, the old ones stop working
+func (s *Service) RegenerateRecoveryCodesHandler(c *fiber.Ctx) error {
+	var req MFACodeRequest
+
+	req = *c.Locals("body").(*MFACodeRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	mfa, err := s.MFA.FindEnabled(c.UserContext(), currentUserID(c))
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "mfa_not_enabled")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+
+	// Only a TOTP code is accepted, a recovery code would be replaced right away
+	step, ok := totp.Validate(mfa.Secret, req.Code, s.Clock())
+	if !ok {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_mfa_code")
+	}
+
+	var recoveryCodes []string
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		used, err := s.MFA.UseStep(ctx, mfa.ID, step)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidMFACode
+		}
+
+		recoveryCodes, err = s.generateRecoveryCodes(ctx, mfa.UserID)
+		return err
+	})
+	if err != nil {
+		if err == errInvalidMFACode {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_mfa_code")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to regenerate recovery codes")
+	}
+
+	return response.SendSuccessResponse(c, "Recovery codes regenerated successfully", fiber.Map{
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// LoginMFAHandler is the second step of the login, it exchanges the MFA token and a code for the access and refresh tokens
+func (s *Service) LoginMFAHandler(c *fiber.Ctx) error {
+	var req LoginMFARequest
+
+	req = *c.Locals("body").(*LoginMFARequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	claims, err := s.Tokens.ParseMFAToken(req.MFAToken)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_mfa_token")
+	}
+
+	// MFA tokens are single use, and a password reset or revocation of the user ends pending challenges
+	revoked, err := revocation.IsRevoked(c.UserContext(), s.Revocations, claims)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to check token revocation")
+	}
+	if revoked {
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_mfa_token")
+	}
+
+	user, err := s.Users.FindByID(c.UserContext(), claims.UserID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_mfa_token")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Wrong codes count toward the same lockout as wrong passwords, so codes cannot be guessed from many IPs
+	lockedFor, err := s.loginLockedFor(c.UserContext(), emailThrottleKey(user.Email), ipThrottleKey(c.IP()))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query login attempts")
+	}
+	if lockedFor > 0 {
+		return s.sendLoginLockedResponse(c, lockedFor)
+	}
+
+	mfa, err := s.MFA.FindEnabled(c.UserContext(), user.ID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_mfa_token") // Disabled in the meantime
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+
+	ok, err := s.verifyMFACode(c.UserContext(), mfa, req.Code)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to verify MFA code")
+	}
+	if !ok {
+		if err := s.recordLoginFailures(c.UserContext(), user.Email, c.IP()); err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to record login attempt")
+		}
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_mfa_code")
+	}
+
+	if err := s.resetLoginFailures(c.UserContext(), user.Email); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to reset login attempts")
+	}
+
+	if err := revocation.RevokeClaims(c.UserContext(), s.Revocations, claims); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to revoke MFA token")
+	}
+
+	return s.completeLogin(c, *user, req.DeviceLabel)
+}
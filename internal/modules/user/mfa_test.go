@@ -0,0 +1,84 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/totp"
+
+	"net/http"
+	"testing"
+	"time"
+)
+
+// enableTestMFA confirms a TOTP second factor for the user and returns its secret
+func enableTestMFA(t *testing.T, s *Service, userID uint) string {
+	t.Helper()
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa := UserMFA{UserID: userID, Secret: secret}
+	if err := s.MFA.Create(t.Context(), &mfa); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MFA.Enable(t.Context(), mfa.ID, s.Clock(), totp.Step(s.Clock())-1); err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// loginMFA answers the MFA challenge with the code of the service clock
+func loginMFA(t *testing.T, s *Service, app *fiber.App, mfaToken, secret string) testResponse {
+	t.Helper()
+
+	code, err := totp.Code(secret, s.Clock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return do(t, app, http.MethodPost, "/login/mfa", LoginMFARequest{MFAToken: mfaToken, Code: code}, nil)
+}
+
+func TestLoginMFA(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	user := addTestUser(t, s, "jane@example.com", true)
+	secret := enableTestMFA(t, s, user.ID)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	mfaToken, _ := res.Data["mfa_token"].(string)
+	if res.Status != fiber.StatusOK || mfaToken == "" || res.Data["access_token"] != nil {
+		t.Fatalf("login = %d %v, want an MFA challenge", res.Status, res.Data)
+	}
+
+	res = loginMFA(t, s, app, mfaToken, secret)
+	if accessToken, _ := res.Data["access_token"].(string); res.Status != fiber.StatusOK || accessToken == "" {
+		t.Fatalf("MFA login = %d (%s), want 200 with an access token", res.Status, res.Code)
+	}
+
+	// Challenges are single use
+	res = loginMFA(t, s, app, mfaToken, secret)
+	if res.Status != fiber.StatusUnauthorized || res.Code != "invalid_mfa_token" {
+		t.Errorf("reused MFA token = %d (%s), want 401 invalid_mfa_token", res.Status, res.Code)
+	}
+}
+
+// A password reset or admin revoke ends the challenges pending for the user
+func TestLoginMFARevokedChallenge(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	user := addTestUser(t, s, "jane@example.com", true)
+	secret := enableTestMFA(t, s, user.ID)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	mfaToken, _ := res.Data["mfa_token"].(string)
+
+	// Revoked in the next time step, so the code itself would be accepted
+	challengedAt := s.Clock()
+	s.Clock = func() time.Time { return challengedAt.Add(totp.Period) }
+	s.revokeUserTokens(t.Context(), user.ID)
+
+	res = loginMFA(t, s, app, mfaToken, secret)
+	if res.Status != fiber.StatusUnauthorized || res.Code != "invalid_mfa_token" {
+		t.Errorf("MFA login after revocation = %d (%s), want 401 invalid_mfa_token", res.Status, res.Code)
+	}
+}
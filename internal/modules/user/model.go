@@ -1,15 +1,17 @@
 package user
 
 import (
-	"time"
-
 	"gorm.io/gorm"
+
+	"time"
 )
 
 type User struct {
-	gorm.Model        // Includes ID, CreatedAt, UpdatedAt, DeletedAt
-	Email      string `json:"email" validate:"required,email" gorm:"unique"`
-	Password   string `json:"password" validate:"required,min=8"`
+	gorm.Model                 // Includes ID, CreatedAt, UpdatedAt, DeletedAt
+	Email           string     `json:"email" validate:"required,email" gorm:"unique"`
+	Password        string     `json:"password" validate:"required,min=8"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	Roles           []Role     `json:"roles" gorm:"many2many:user_roles"`
 	// Add other fields as needed
 }
 
@@ -18,28 +20,270 @@ type UserDetail struct {
 	UserID    uint   `gorm:"uniqueIndex"` // Ensure one-to-one relationship
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
+	Phone     string `json:"phone"`
+	Bio       string `json:"bio"`
+	AvatarURL string `json:"avatar_url"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	// Add more fields as needed
 }
 
 type UserSession struct {
+	ID         uint       `gorm:"primaryKey"`
+	UserID     uint       `gorm:"index"` // Rotated sessions are kept, so a user has many rows
+	JTI        string     `json:"jti" gorm:"uniqueIndex;size:36"`
+	FamilyID   string     `json:"family_id" gorm:"index;size:36"` // Shared by every session rotated from the same login
+	ParentID   *uint      `json:"parent_id"`                      // Session this one was rotated from
+	RotatedAt  *time.Time `json:"rotated_at"`                     // Set when the refresh token was exchanged
+	Label      string     `json:"label" gorm:"size:100"`          // Device label chosen by the client at login
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address" gorm:"size:64"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+}
+
+type SecurityEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Type      string    `json:"type" gorm:"index;size:64"`
+	FamilyID  string    `json:"family_id" gorm:"size:36"`
+	IPAddress string    `json:"ip_address" gorm:"size:64"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index"`
+	TokenHash string     `gorm:"uniqueIndex;size:64"` // SHA-256 hex of the token sent by email
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type EmailVerificationToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index"`
+	TokenHash string     `gorm:"uniqueIndex;size:64"` // SHA-256 hex of the token sent by email
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserMFA is the TOTP second factor of a user
+type UserMFA struct {
+	ID           uint       `gorm:"primaryKey"`
+	UserID       uint       `gorm:"uniqueIndex"`
+	Secret       string     `gorm:"size:64"`    // Base32 TOTP secret
+	EnabledAt    *time.Time `json:"enabled_at"` // Nil until the setup is confirmed with a code
+	LastUsedStep int64      // Last accepted time step, so a code is never accepted twice
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+type MFARecoveryCode struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"index"`
+	CodeHash  string     `gorm:"uniqueIndex;size:64"` // SHA-256 hex of the normalized recovery code
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity links a user to an account of an OpenID Connect provider
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Provider    string     `json:"provider" gorm:"uniqueIndex:idx_user_identities_provider_subject;size:64"`
+	Subject     string     `json:"-" gorm:"uniqueIndex:idx_user_identities_provider_subject;size:255"` // "sub" claim of the ID token
+	Email       string     `json:"email"`                                                              // Email at the provider, informative only
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+}
+
+// OAuthState is a pending authorization request, bound to the browser by the oauth_state cookie
+type OAuthState struct {
+	ID           uint      `gorm:"primaryKey"`
+	StateHash    string    `gorm:"uniqueIndex;size:64"` // SHA-256 hex of the state parameter
+	Provider     string    `gorm:"size:64"`
+	Nonce        string    `gorm:"size:64"`
+	CodeVerifier string    `gorm:"size:128"` // PKCE code verifier
+	LinkUserID   *uint     // Set when a signed in user links a new identity
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+// TableName overrides the default "o_auth_states"
+func (OAuthState) TableName() string {
+	return "oauth_states"
+}
+
+// APIKey is a personal access token for scripts and machine clients. Only the hash is stored.
+type APIKey struct {
 	ID         uint      `gorm:"primaryKey"`
-	UserID     uint      `gorm:"uniqueIndex"` // Ensure one-to-one relationship
-	JTI        string    `json:"jti" gorm:"uniqueIndex"`
-	CreatedAt  time.Time `json:"created_at"`
-	ExpiresAt  time.Time `json:"expires_at"`
-	LastSeenAt time.Time `json:"last_seen_at"`
+	UserID     uint      `gorm:"index"`
+	Name       string    `gorm:"size:100"`
+	Prefix     string    `gorm:"size:16"`             // First characters of the key, to recognize it in listings
+	KeyHash    string    `gorm:"uniqueIndex;size:64"` // SHA-256 hex of the key
+	Scopes     string    // Space separated permissions, the key never has more than its user
+	ExpiresAt  time.Time `gorm:"index"`
+	LastUsedAt *time.Time
+	LastUsedIP string `gorm:"size:64"`
+	CreatedAt  time.Time
+}
+
+// LoginThrottle counts failed logins of an email address or a client IP
+type LoginThrottle struct {
+	ID            uint       `gorm:"primaryKey"`
+	ThrottleKey   string     `gorm:"uniqueIndex;size:320"` // "email:<address>" or "ip:<address>"
+	Failures      int        // Consecutive failures, reset by a successful login or after a quiet window
+	LastFailureAt time.Time  `gorm:"index"`
+	LockedUntil   *time.Time // Logins are refused until this time
+}
+
+type Role struct {
+	ID          uint         `gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex;size:64"`
+	Permissions []Permission `json:"permissions" gorm:"many2many:role_permissions"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Permission struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `json:"name" gorm:"uniqueIndex;size:64"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
 }
 
 type LoginRequest struct {
-	Email    string `json:"email" validate:"required,email"`
-	Password string `json:"password" validate:"required"`
+	Email       string `json:"email" validate:"required,email"`
+	Password    string `json:"password" validate:"required"`
+	DeviceLabel string `json:"device_label" validate:"omitempty,max=100"`
+}
+
+type LoginMFARequest struct {
+	MFAToken    string `json:"mfa_token" validate:"required"`
+	Code        string `json:"code" validate:"required,max=32"` // TOTP code or recovery code
+	DeviceLabel string `json:"device_label" validate:"omitempty,max=100"`
+}
+
+type OAuthCallbackRequest struct {
+	Code        string `json:"code" validate:"required"`
+	State       string `json:"state" validate:"required"`
+	DeviceLabel string `json:"device_label" validate:"omitempty,max=100"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name" validate:"required,max=100"`
+	Scopes        []string `json:"scopes" validate:"omitempty,dive,required"`
+	ExpiresInDays int      `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
 }
 
 type CreateUserRequest struct {
 	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required"`
+	Password  string `json:"password" validate:"required,password"`
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 }
+
+type UpdateCurrentUserRequest struct {
+	FirstName *string `json:"first_name" validate:"omitnil,min=1,max=100"`
+	LastName  *string `json:"last_name" validate:"omitnil,min=1,max=100"`
+	Phone     *string `json:"phone" validate:"omitnil,len=0|e164"`
+	Bio       *string `json:"bio" validate:"omitnil,max=500"`
+	AvatarURL *string `json:"avatar_url" validate:"omitnil,len=0|url"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword    string `json:"current_password" validate:"required"`
+	NewPassword        string `json:"new_password" validate:"required,password"`
+	KeepCurrentSession bool   `json:"keep_current_session"`
+}
+
+type ListUsersQuery struct {
+	Page           int    `query:"page" json:"page" validate:"omitempty,min=1"`
+	PerPage        int    `query:"per_page" json:"per_page" validate:"omitempty,min=1,max=100"`
+	Email          string `query:"email" json:"email"`
+	Name           string `query:"name" json:"name"`
+	CreatedFrom    string `query:"created_from" json:"created_from" validate:"omitempty,datetime=2006-01-02"`
+	CreatedTo      string `query:"created_to" json:"created_to" validate:"omitempty,datetime=2006-01-02"`
+	Sort           string `query:"sort" json:"sort" validate:"omitempty,oneof=id -id email -email created_at -created_at first_name -first_name last_name -last_name"`
+	IncludeDeleted bool   `query:"include_deleted" json:"include_deleted"`
+}
+
+type AdminUpdateUserRequest struct {
+	Email     *string   `json:"email" validate:"omitnil,email"`
+	FirstName *string   `json:"first_name" validate:"omitnil,min=1,max=100"`
+	LastName  *string   `json:"last_name" validate:"omitnil,min=1,max=100"`
+	Phone     *string   `json:"phone" validate:"omitnil,len=0|e164"`
+	Bio       *string   `json:"bio" validate:"omitnil,max=500"`
+	AvatarURL *string   `json:"avatar_url" validate:"omitnil,len=0|url"`
+	Roles     *[]string `json:"roles" validate:"omitnil,dive,required"`
+}
+
+// UserResponse is the admin view of a user joined with its detail
+type UserResponse struct {
+	ID              uint       `json:"id"`
+	Email           string     `json:"email"`
+	FirstName       string     `json:"first_name"`
+	LastName        string     `json:"last_name"`
+	Phone           string     `json:"phone"`
+	Bio             string     `json:"bio"`
+	AvatarURL       string     `json:"avatar_url"`
+	Roles           []string   `json:"roles" gorm:"-"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	DeletedAt       *time.Time `json:"deleted_at"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type ResendVerificationEmailRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type MFACodeRequest struct {
+	Code string `json:"code" validate:"required,max=32"`
+}
+
+type DisableMFARequest struct {
+	Password string `json:"password" validate:"required"`
+	Code     string `json:"code" validate:"required,max=32"` // TOTP code or recovery code
+}
+
+// APIKeyResponse is an API key of the current user, without the secret
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// SessionResponse is a device session of the current user
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	Label      string    `json:"label"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	Current    bool      `json:"current"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
@@ -0,0 +1,352 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/oidc"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Lifetime of a pending authorization request
+const (
+	oauthStateTTL = 10 * time.Minute
+)
+
+var (
+	errIdentityLinkedToOtherUser = errors.New("identity already linked to another user")
+	errAccountExists             = errors.New("an account with this email already exists")
+	errOAuthEmailRequired        = errors.New("the provider did not return an email address")
+)
+
+// oauthLinkByEmail reports whether a new identity is linked to an existing account with the same email.
+// Only emails verified by the provider are trusted. Set OIDC_LINK_BY_EMAIL=false to always require an explicit link.
+func (s *Service) oauthLinkByEmail() bool {
+	return s.Config.OIDC.LinkByEmail
+}
+
+// setOAuthStateCookie binds the authorization request to the browser, against login CSRF
+func (s *Service) setOAuthStateCookie(c *fiber.Ctx, state string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "oauth_state",
+		Value:    state,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Expires:  expires,
+		Secure:   s.Config.App.IsProduction(), // Only send cookie over HTTPS in production
+		Path:     "/v1/oauth",
+	})
+}
+
+// startAuthorization stores a pending authorization request and responds with the provider URL.
+// linkUserID is set when a signed in user links a new identity.
+func (s *Service) startAuthorization(c *fiber.Ctx, linkUserID *uint) error {
+	provider, err := s.OIDC.Get(c.Params("provider"))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "unknown_provider")
+	}
+
+	state, stateHash, err := generateOneTimeToken()
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate state")
+	}
+	nonce, _, err := generateOneTimeToken()
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate nonce")
+	}
+	codeVerifier, codeChallenge, err := oidc.NewPKCE()
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate PKCE verifier")
+	}
+
+	authorizationURL, err := provider.AuthCodeURL(c.UserContext(), state, nonce, codeChallenge)
+	if err != nil {
+		s.Logger.ErrorContext(c.UserContext(), "OIDC provider discovery failed", "provider", provider.Config.Name, "error", err)
+		return response.SendErrorResponse(c, fiber.StatusBadGateway, "oauth_provider_error")
+	}
+
+	now := s.Clock()
+	oauthState := OAuthState{
+		StateHash:    stateHash,
+		Provider:     provider.Config.Name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    now.Add(oauthStateTTL),
+		CreatedAt:    now,
+	}
+	if err := s.OAuth.CreateState(c.UserContext(), &oauthState); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to store authorization request")
+	}
+
+	s.setOAuthStateCookie(c, state, oauthState.ExpiresAt)
+
+	return response.SendSuccessResponse(c, "Redirect to the provider to continue", fiber.Map{
+		"authorization_url": authorizationURL,
+	})
+}
+
+// OAuthAuthorizeHandler starts a login with an OpenID Connect provider
+func (s *Service) OAuthAuthorizeHandler(c *fiber.Ctx) error {
+	return s.startAuthorization(c, nil)
+}
+
+// LinkIdentityHandler starts linking an OpenID Connect provider account to the current user
+func (s *Service) LinkIdentityHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+	return s.startAuthorization(c, &userID)
+}
+
+// OAuthCallbackHandler completes the authorization with the code and state the provider redirected back with.
+// It logs the user in like LoginUserHandler, or links the identity if the request was started by LinkIdentityHandler.
+func (s *Service) OAuthCallbackHandler(c *fiber.Ctx) error {
+	var req OAuthCallbackRequest
+
+	req = *c.Locals("body").(*OAuthCallbackRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	provider, err := s.OIDC.Get(c.Params("provider"))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "unknown_provider")
+	}
+
+	// The state must come from the browser that started the request
+	if subtle.ConstantTimeCompare([]byte(c.Cookies("oauth_state")), []byte(req.State)) != 1 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_oauth_state")
+	}
+	s.setOAuthStateCookie(c, "", s.Clock().Add(-time.Hour))
+
+	oauthState, err := s.OAuth.FindState(c.UserContext(), hashOneTimeToken(req.State), provider.Config.Name, s.Clock())
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_oauth_state")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query authorization request")
+	}
+
+	// States are single use
+	deleted, err := s.OAuth.DeleteState(c.UserContext(), oauthState.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to delete authorization request")
+	}
+	if !deleted {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_oauth_state")
+	}
+
+	tokenResponse, err := provider.Exchange(c.UserContext(), req.Code, oauthState.CodeVerifier)
+	if err != nil {
+		s.Logger.WarnContext(c.UserContext(), "OIDC provider code exchange failed", "provider", provider.Config.Name, "error", err)
+		return response.SendErrorResponse(c, fiber.StatusBadGateway, "oauth_provider_error")
+	}
+
+	claims, err := provider.VerifyIDToken(c.UserContext(), tokenResponse.IDToken, oauthState.Nonce)
+	if err != nil {
+		s.Logger.WarnContext(c.UserContext(), "OIDC provider returned an invalid ID token", "provider", provider.Config.Name, "error", err)
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_id_token")
+	}
+
+	if oauthState.LinkUserID != nil {
+		return s.linkIdentity(c, *oauthState.LinkUserID, provider.Config.Name, claims)
+	}
+
+	user, err := s.findOrCreateOAuthUser(c.UserContext(), provider.Config.Name, claims)
+	if err != nil {
+		switch err {
+		case errAccountExists:
+			return response.SendErrorResponse(c, fiber.StatusConflict, "account_exists")
+		case errOAuthEmailRequired:
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "oauth_email_required")
+		case ErrNotFound:
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_credentials") // Linked user was deleted
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to sign in with provider")
+	}
+
+	// Same rules as LoginUserHandler after the password check
+	if s.EmailVerificationPolicy() == EmailVerificationRequire && user.EmailVerifiedAt == nil {
+		return response.SendErrorResponse(c, fiber.StatusForbidden, "email_not_verified")
+	}
+
+	mfaEnabled, err := s.isMFAEnabled(c.UserContext(), user.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user MFA")
+	}
+	if mfaEnabled {
+		return s.sendMFAChallenge(c, user)
+	}
+
+	return s.completeLogin(c, user, req.DeviceLabel)
+}
+
+// findOrCreateOAuthUser returns the user linked to the identity. Without a link, an account with the same
+// verified email is linked (if allowed by OIDC_LINK_BY_EMAIL), otherwise a new account is created.
+// Unverified accounts are never linked automatically, their owner has to verify the email or link explicitly.
+func (s *Service) findOrCreateOAuthUser(ctx context.Context, provider string, claims *oidc.IDTokenClaims) (User, error) {
+	var user User
+	now := s.Clock()
+
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		// Known identity
+		identity, err := s.OAuth.FindIdentity(ctx, provider, claims.Subject)
+		if err == nil {
+			linked, err := s.Users.FindByID(ctx, identity.UserID)
+			if err != nil {
+				return err
+			}
+			user = *linked
+			return s.OAuth.TouchIdentity(ctx, identity.ID, claims.Email, now)
+		}
+		if err != ErrNotFound {
+			return err
+		}
+
+		if claims.Email == "" {
+			return errOAuthEmailRequired
+		}
+
+		existing, err := s.Users.FindByEmail(ctx, claims.Email)
+		switch {
+		case err == nil:
+			user = *existing
+			// Existing account, link only if the provider vouches for the email and the account owner
+			// proved it as well. Anyone can register an unverified account with someone else's email and
+			// a password of their choice, linking it would hand them the account of the real owner.
+			if !claims.EmailVerified || !s.oauthLinkByEmail() || user.EmailVerifiedAt == nil {
+				return errAccountExists
+			}
+		case err == ErrNotFound:
+			// Deleted users keep their email, a new account would violate the unique index
+			deleted, err := s.Users.EmailExists(ctx, claims.Email, true)
+			if err != nil {
+				return err
+			}
+			if deleted {
+				return errAccountExists
+			}
+
+			// New account
+			if err := s.createOAuthUser(ctx, &user, claims); err != nil {
+				return err
+			}
+		default:
+			return err
+		}
+
+		return s.OAuth.CreateIdentity(ctx, &UserIdentity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+			CreatedAt:   now,
+		})
+	})
+
+	return user, err
+}
+
+// createOAuthUser creates a user from the ID token claims. The password is random, the user can set one with
+// the password reset flow.
+func (s *Service) createOAuthUser(ctx context.Context, user *User, claims *oidc.IDTokenClaims) error {
+	randomPassword, _, err := generateOneTimeToken()
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	now := s.Clock()
+	*user = User{Email: claims.Email, Password: string(hashedPassword)}
+	user.CreatedAt, user.UpdatedAt = now, now
+	if claims.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.Users.Create(ctx, user); err != nil {
+		return err
+	}
+
+	// Fall back to the full name, then to the email local part
+	firstName, lastName := claims.GivenName, claims.FamilyName
+	if firstName == "" {
+		firstName, lastName, _ = strings.Cut(claims.Name, " ")
+	}
+	if firstName == "" {
+		firstName, _, _ = strings.Cut(claims.Email, "@")
+	}
+
+	if err := s.Users.CreateDetail(ctx, &UserDetail{UserID: user.ID, FirstName: firstName, LastName: lastName}); err != nil {
+		return err
+	}
+
+	// Every new user gets the default role
+	return s.Roles.Assign(ctx, user.ID, RoleUser)
+}
+
+// linkIdentity links the identity to the user that started the authorization request
+func (s *Service) linkIdentity(c *fiber.Ctx, userID uint, provider string, claims *oidc.IDTokenClaims) error {
+	err := s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		identity, err := s.OAuth.FindIdentity(ctx, provider, claims.Subject)
+		if err == nil {
+			if identity.UserID != userID {
+				return errIdentityLinkedToOtherUser
+			}
+			return nil // Already linked
+		}
+		if err != ErrNotFound {
+			return err
+		}
+
+		return s.OAuth.CreateIdentity(ctx, &UserIdentity{UserID: userID, Provider: provider, Subject: claims.Subject, Email: claims.Email, CreatedAt: s.Clock()})
+	})
+	if err != nil {
+		if err == errIdentityLinkedToOtherUser {
+			return response.SendErrorResponse(c, fiber.StatusConflict, "identity_already_linked")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to link identity")
+	}
+
+	return response.SendSuccessResponse(c, "Identity linked successfully", nil)
+}
+
+func (s *Service) ListIdentitiesHandler(c *fiber.Ctx) error {
+	identities, err := s.OAuth.ListIdentities(c.UserContext(), currentUserID(c))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query identities")
+	}
+
+	return response.SendSuccessResponse(c, "Identities fetched successfully", identities)
+}
+
+func (s *Service) UnlinkIdentityHandler(c *fiber.Ctx) error {
+	identityID, err := c.ParamsInt("id")
+	if err != nil || identityID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "identity_not_found")
+	}
+
+	deleted, err := s.OAuth.DeleteIdentity(c.UserContext(), currentUserID(c), uint(identityID))
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to unlink identity")
+	}
+	if !deleted {
+		return response.SendErrorResponse(c, fiber.StatusNotFound, "identity_not_found")
+	}
+
+	return response.SendSuccessResponse(c, "Identity unlinked successfully", nil)
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/oidc"
+
+	"testing"
+)
+
+func idTokenClaims(subject, email string, emailVerified bool) *oidc.IDTokenClaims {
+	return &oidc.IDTokenClaims{
+		Email:            email,
+		EmailVerified:    emailVerified,
+		Name:             "Jane Doe",
+		RegisteredClaims: jwt.RegisteredClaims{Subject: subject},
+	}
+}
+
+func TestFindOrCreateOAuthUserCreatesAccount(t *testing.T) {
+	s := newTestService(t)
+
+	user, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Email != "jane@example.com" || user.EmailVerifiedAt == nil {
+		t.Fatalf("user = %+v, want a new verified account", user)
+	}
+
+	// The identity signs in to the same account again
+	again, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != user.ID {
+		t.Errorf("second sign in got user %d, want %d", again.ID, user.ID)
+	}
+
+	roles, _, err := s.GetUserRolesAndPermissions(t.Context(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != RoleUser {
+		t.Errorf("roles = %v, want [%s]", roles, RoleUser)
+	}
+}
+
+func TestFindOrCreateOAuthUserLinksVerifiedAccount(t *testing.T) {
+	s := newTestService(t)
+	existing := addTestUser(t, s, "jane@example.com", true)
+
+	user, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != existing.ID {
+		t.Errorf("linked user %d, want %d", user.ID, existing.ID)
+	}
+}
+
+// An attacker who registered the victim's email first must not get the account once the victim signs in
+// with a provider
+func TestFindOrCreateOAuthUserRefusesUnverifiedAccount(t *testing.T) {
+	s := newTestService(t)
+	existing := addTestUser(t, s, "jane@example.com", false)
+
+	if _, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", true)); err != errAccountExists {
+		t.Fatalf("error = %v, want errAccountExists", err)
+	}
+	identities, err := s.OAuth.ListIdentities(t.Context(), existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(identities) != 0 {
+		t.Errorf("identities = %+v, want none", identities)
+	}
+}
+
+func TestFindOrCreateOAuthUserRefusesUnverifiedProviderEmail(t *testing.T) {
+	s := newTestService(t)
+	addTestUser(t, s, "jane@example.com", true)
+
+	if _, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", false)); err != errAccountExists {
+		t.Errorf("error = %v, want errAccountExists", err)
+	}
+}
+
+func TestFindOrCreateOAuthUserRefusesLinkByEmailWhenDisabled(t *testing.T) {
+	s := newTestService(t)
+	s.Config.OIDC.LinkByEmail = false
+	addTestUser(t, s, "jane@example.com", true)
+
+	if _, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "jane@example.com", true)); err != errAccountExists {
+		t.Errorf("error = %v, want errAccountExists", err)
+	}
+}
+
+func TestFindOrCreateOAuthUserRequiresEmail(t *testing.T) {
+	s := newTestService(t)
+
+	if _, err := s.findOrCreateOAuthUser(t.Context(), "mock", idTokenClaims("sub-1", "", false)); err != errOAuthEmailRequired {
+		t.Errorf("error = %v, want errOAuthEmailRequired", err)
+	}
+}
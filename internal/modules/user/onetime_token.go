@@ -0,0 +1,26 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// generateOneTimeToken returns a random URL-safe token and its hash. Only the hash is stored,
+// the raw token is sent to the user.
+func generateOneTimeToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	raw := base64.RawURLEncoding.EncodeToString(b)
+	return raw, hashOneTimeToken(raw), nil
+}
+
+// hashOneTimeToken returns the SHA-256 hex digest of a token
+func hashOneTimeToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"unicode"
+)
+
+// Password policy limits, bcrypt only uses the first 72 bytes of a password
+const (
+	passwordMinLength = 8
+	passwordMaxLength = 72
+)
+
+// validatePasswordPolicy is registered as the "password" validation tag. A valid password
+// has 8 to 72 bytes and contains at least one uppercase letter, one lowercase letter and one digit.
+func validatePasswordPolicy(fl validator.FieldLevel) bool {
+	password := fl.Field().String()
+	if len(password) < passwordMinLength || len(password) > passwordMaxLength {
+		return false
+	}
+
+	var hasUpper, hasLower, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+
+	return hasUpper && hasLower && hasDigit
+}
+
+func (s *Service) ChangePasswordHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	var req ChangePasswordRequest
+
+	req = *c.Locals("body").(*ChangePasswordRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Verify current password, respond with 400 (not 401) so clients don't try to refresh the token
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_current_password")
+	}
+
+	// New password must differ from the current one
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.NewPassword)); err == nil {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "password_unchanged")
+	}
+
+	// Hash new password, use bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to hash password")
+	}
+
+	stateful := s.Config.Session.Stateful()
+
+	// Current session is identified by the rotation family of the refresh token
+	currentFamilyID := ""
+	if stateful && req.KeepCurrentSession {
+		currentFamilyID = s.currentSessionFamilyID(c, user.ID)
+	}
+
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		if err := s.Users.UpdatePassword(ctx, user.ID, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		if !stateful {
+			return nil
+		}
+
+		// Revoke all other sessions, so stolen refresh tokens stop working immediately
+		if currentFamilyID != "" {
+			return s.Sessions.DeleteOtherFamilies(ctx, user.ID, currentFamilyID)
+		}
+		return s.Sessions.DeleteByUser(ctx, user.ID)
+	})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to change password")
+	}
+
+	// Revoke every token issued so far, the kept session gets a new access token on refresh
+	s.revokeUserTokens(c.UserContext(), user.ID)
+
+	// Current session was revoked as well, clear the refresh token cookie.
+	// In stateless mode the refresh token is revoked by the watermark, so there is no session to keep.
+	if currentFamilyID == "" {
+		s.clearRefreshTokenCookie(c)
+	}
+
+	return response.SendSuccessResponse(c, "Password changed successfully", nil)
+}
@@ -0,0 +1,161 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+	"golang.org/x/crypto/bcrypt"
+
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+var errResetTokenUsed = errors.New("password reset token already used")
+
+func (s *Service) ForgotPasswordHandler(c *fiber.Ctx) error {
+	var req ForgotPasswordRequest
+
+	req = *c.Locals("body").(*ForgotPasswordRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	// Always return the same message, so the response does not reveal whether the email exists
+	const message = "If the email is registered, a password reset link has been sent"
+
+	user, err := s.Users.FindByEmail(c.UserContext(), req.Email)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendSuccessResponse(c, message, nil)
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Create the token and send the email after responding, so the response time does not reveal
+	// whether the email exists either. The request context ends with the response.
+	go s.sendPasswordReset(context.WithoutCancel(c.UserContext()), *user)
+
+	return response.SendSuccessResponse(c, message, nil)
+}
+
+// sendPasswordReset replaces the reset token of the user and emails it. It runs after the response,
+// failures are only logged.
+func (s *Service) sendPasswordReset(ctx context.Context, user User) {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(s.Config.App.RequestTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	rawToken, tokenHash, err := generateOneTimeToken()
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to generate password reset token", "target_user_id", user.ID, "error", err)
+		return
+	}
+
+	resetTokenExpire := s.Config.PasswordReset.TokenExpireMinutes
+
+	now := s.Clock()
+	resetToken := PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: now.Add(time.Duration(resetTokenExpire) * time.Minute),
+		CreatedAt: now,
+	}
+
+	// Only the latest reset token of a user is usable
+	err = s.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.PasswordResetTokens.DeleteUnused(ctx, user.ID); err != nil {
+			return err
+		}
+		return s.PasswordResetTokens.Create(ctx, &resetToken)
+	})
+	if err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to create password reset token", "target_user_id", user.ID, "error", err)
+		return
+	}
+
+	resetURL := s.Config.PasswordReset.URL
+
+	msg := mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("We received a request to reset your password.\n\n"+
+			"Open the link below to choose a new password, it expires in %d minutes:\n%s?token=%s\n\n"+
+			"If you did not request a password reset, you can ignore this email.\n",
+			resetTokenExpire, resetURL, url.QueryEscape(rawToken)),
+	}
+	if err := s.Mailer.Send(ctx, msg); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to send password reset email", "target_user_id", user.ID, "error", err)
+	}
+}
+
+func (s *Service) ResetPasswordHandler(c *fiber.Ctx) error {
+	var req ResetPasswordRequest
+
+	req = *c.Locals("body").(*ResetPasswordRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	resetToken, err := s.PasswordResetTokens.FindValid(c.UserContext(), hashOneTimeToken(req.Token), s.Clock())
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_reset_token")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query reset token")
+	}
+
+	// Hash password, use bcrypt
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to hash password")
+	}
+
+	err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+		// Mark token as used, only once
+		used, err := s.PasswordResetTokens.Use(ctx, resetToken.ID, s.Clock())
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errResetTokenUsed
+		}
+
+		if err := s.Users.UpdatePassword(ctx, resetToken.UserID, string(hashedPassword)); err != nil {
+			return err
+		}
+
+		// Invalidate every existing session of the user
+		return s.Sessions.DeleteByUser(ctx, resetToken.UserID)
+	})
+	if err != nil {
+		if err == errResetTokenUsed || err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_reset_token")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to reset password")
+	}
+
+	s.revokeUserTokens(c.UserContext(), resetToken.UserID)
+
+	// Proving access to the mailbox lifts a login lockout, ignore errors, the password is already reset
+	if user, err := s.Users.FindByID(c.UserContext(), resetToken.UserID); err == nil {
+		_ = s.resetLoginFailures(c.UserContext(), user.Email)
+	}
+
+	return response.SendSuccessResponse(c, "Password reset successfully", nil)
+}
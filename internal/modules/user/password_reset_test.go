@@ -0,0 +1,84 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+
+	"context"
+	"net/http"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// blockingMailer hands every email to sent and holds the sender until release is closed
+type blockingMailer struct {
+	sent    chan mailer.Message
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent <- msg
+	<-m.release
+	return nil
+}
+
+var tokenLinkPattern = regexp.MustCompile(`\?token=(\S+)`)
+
+// linkToken returns the token of the link in an email body
+func linkToken(t *testing.T, body string) string {
+	t.Helper()
+
+	match := tokenLinkPattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("email body %q has no token link", body)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestForgotAndResetPassword(t *testing.T) {
+	s := newTestService(t)
+	mails := &blockingMailer{sent: make(chan mailer.Message, 1), release: make(chan struct{})}
+	s.Mailer = mails
+	app := newTestApp(s)
+	app.Post("/forgot-password", parseBody[ForgotPasswordRequest](), s.ForgotPasswordHandler)
+	app.Post("/reset-password", parseBody[ResetPasswordRequest](), s.ResetPasswordHandler)
+	addTestUser(t, s, "jane@example.com", true)
+
+	// Known and unknown emails get the same response, without waiting for the email
+	unknown := do(t, app, http.MethodPost, "/forgot-password", ForgotPasswordRequest{Email: "nobody@example.com"}, nil)
+	known := do(t, app, http.MethodPost, "/forgot-password", ForgotPasswordRequest{Email: "jane@example.com"}, nil)
+	close(mails.release)
+	if unknown.Status != fiber.StatusOK || known.Status != fiber.StatusOK {
+		t.Fatalf("forgot password = %d and %d, want 200 for both", unknown.Status, known.Status)
+	}
+
+	var msg mailer.Message
+	select {
+	case msg = <-mails.sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no password reset email sent")
+	}
+	if len(msg.To) != 1 || msg.To[0] != "jane@example.com" {
+		t.Fatalf("email sent to %v, want jane@example.com", msg.To)
+	}
+	resetToken := linkToken(t, msg.Body)
+
+	res := do(t, app, http.MethodPost, "/reset-password", ResetPasswordRequest{Token: resetToken, NewPassword: "Changed123!"}, nil)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("reset password = %d (%s), want 200", res.Status, res.Code)
+	}
+	res = do(t, app, http.MethodPost, "/reset-password", ResetPasswordRequest{Token: resetToken, NewPassword: "Again123!"}, nil)
+	if res.Status != fiber.StatusBadRequest || res.Code != "invalid_reset_token" {
+		t.Errorf("reused reset token = %d (%s), want 400 invalid_reset_token", res.Status, res.Code)
+	}
+
+	if res := login(t, app, "jane@example.com", "Changed123!"); res.Status != fiber.StatusOK {
+		t.Errorf("login with the new password = %d (%s), want 200", res.Status, res.Code)
+	}
+}
@@ -0,0 +1,120 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChangePassword(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	app.Put("/me/password", authenticate(s), parseBody[ChangePasswordRequest](), s.ChangePasswordHandler)
+	addTestUser(t, s, "jane@example.com", true)
+
+	// Signed in on two devices
+	current := login(t, app, "jane@example.com", testPassword)
+	other := login(t, app, "jane@example.com", testPassword)
+	if current.Status != fiber.StatusOK || other.Status != fiber.StatusOK {
+		t.Fatalf("login status = %d and %d, want 200", current.Status, other.Status)
+	}
+	accessToken, _ := current.Data["access_token"].(string)
+	currentRefreshToken, _ := current.Data["refresh_token"].(string)
+	otherRefreshToken, _ := other.Data["refresh_token"].(string)
+	headers := bearer(accessToken)
+	headers["X-Refresh-Token"] = currentRefreshToken
+
+	tests := []struct {
+		name     string
+		req      ChangePasswordRequest
+		wantCode string
+	}{
+		{"wrong current password", ChangePasswordRequest{CurrentPassword: "Wrong123!", NewPassword: "Changed123!"}, "invalid_current_password"},
+		{"weak new password", ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "changed"}, "validation_error"},
+		{"same password", ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: testPassword}, "password_unchanged"},
+	}
+	for _, tt := range tests {
+		res := do(t, app, http.MethodPut, "/me/password", tt.req, headers)
+		if res.Status != fiber.StatusBadRequest || res.Code != tt.wantCode {
+			t.Errorf("%s: change password = %d (%s), want 400 %s", tt.name, res.Status, res.Code, tt.wantCode)
+		}
+	}
+
+	res := do(t, app, http.MethodPut, "/me/password", ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "Changed123!", KeepCurrentSession: true}, headers)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("change password = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	// Access tokens issued before the change stop working at once
+	if res := do(t, app, http.MethodGet, "/me", nil, bearer(accessToken)); res.Status != fiber.StatusUnauthorized {
+		t.Errorf("current user with an old access token = %d, want 401", res.Status)
+	}
+
+	// The other device is signed out, the current one refreshes into new tokens
+	changedAt := s.Clock()
+	s.Clock = func() time.Time { return changedAt.Add(time.Second) }
+	if res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": otherRefreshToken}); res.Status != fiber.StatusUnauthorized {
+		t.Errorf("refresh on the other device = %d (%s), want 401", res.Status, res.Code)
+	}
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": currentRefreshToken})
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("refresh on the current device = %d (%s), want 200", res.Status, res.Code)
+	}
+	accessToken, _ = res.Data["access_token"].(string)
+	if res := do(t, app, http.MethodGet, "/me", nil, bearer(accessToken)); res.Status != fiber.StatusOK {
+		t.Errorf("current user with the refreshed access token = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	if res := login(t, app, "jane@example.com", testPassword); res.Status != fiber.StatusUnauthorized {
+		t.Errorf("login with the old password = %d (%s), want 401", res.Status, res.Code)
+	}
+	if res := login(t, app, "jane@example.com", "Changed123!"); res.Status != fiber.StatusOK {
+		t.Errorf("login with the new password = %d (%s), want 200", res.Status, res.Code)
+	}
+}
+
+func TestChangePasswordSignsOutEverySession(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	app.Put("/me/password", authenticate(s), parseBody[ChangePasswordRequest](), s.ChangePasswordHandler)
+	user := addTestUser(t, s, "jane@example.com", true)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	accessToken, _ := res.Data["access_token"].(string)
+	res = do(t, app, http.MethodPut, "/me/password", ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: "Changed123!"}, bearer(accessToken))
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("change password = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	sessions, err := s.Sessions.ListActive(t.Context(), user.ID, s.Clock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Errorf("%d active sessions after changing the password, want 0", len(sessions))
+	}
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"Secret123", true},
+		{"Sécret123", true},
+		{"Short1A", false},
+		{"secret123", false},
+		{"SECRET123", false},
+		{"SecretPassword", false},
+		{"Aa1" + strings.Repeat("x", 69), true},
+		{"Aa1" + strings.Repeat("x", 70), false}, // bcrypt ignores bytes after the 72nd
+	}
+	for _, tt := range tests {
+		if got := validate.Var(tt.password, "password") == nil; got != tt.want {
+			t.Errorf("password %q valid = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
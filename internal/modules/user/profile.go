@@ -0,0 +1,99 @@
+package user
+
+import (
+	"github.com/go-playground/validator/v10"
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/utility"
+
+	"context"
+)
+
+func (s *Service) UpdateCurrentUserHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	var req UpdateCurrentUserRequest
+
+	req = *c.Locals("body").(*UpdateCurrentUserRequest) // Get parsed body from context, after middleware parsing
+
+	// Validate input
+	if err := validate.Struct(&req); err != nil {
+		if validationErrors, ok := err.(validator.ValidationErrors); ok {
+			errors := utility.FormatValidationErrors(req, validationErrors)
+			return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", errors)
+		}
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "validation_error", err.Error())
+	}
+
+	// Only update the fields that are present in the request
+	err := s.Users.UpdateDetail(c.UserContext(), userID, UserDetailUpdate{
+		FirstName: req.FirstName,
+		LastName:  req.LastName,
+		Phone:     req.Phone,
+		Bio:       req.Bio,
+		AvatarURL: req.AvatarURL,
+	})
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to update user details")
+	}
+
+	userDetail, err := s.Users.FindDetail(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "user_detail_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user details")
+	}
+
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user")
+	}
+
+	// Return updated user details
+	return response.SendSuccessResponse(c, "User updated successfully", fiber.Map{
+		"id":         user.ID,
+		"first_name": userDetail.FirstName,
+		"last_name":  userDetail.LastName,
+		"phone":      userDetail.Phone,
+		"bio":        userDetail.Bio,
+		"avatar_url": userDetail.AvatarURL,
+		"email":      user.Email,
+	})
+}
+
+func (s *Service) DeleteCurrentUserHandler(c *fiber.Ctx) error {
+	userID := currentUserID(c)
+
+	if err := s.deleteUserAndSessions(c.UserContext(), userID); err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to delete user")
+	}
+
+	// Clear the refresh token cookie, same as logout
+	s.clearRefreshTokenCookie(c)
+
+	return response.SendSuccessResponse(c, "User deleted successfully", nil)
+}
+
+// deleteUserAndSessions soft deletes a user and revokes every session of the user in one transaction
+func (s *Service) deleteUserAndSessions(ctx context.Context, userID uint) error {
+	err := s.Transaction(ctx, func(ctx context.Context) error {
+		if err := s.Users.Delete(ctx, userID); err != nil {
+			return err
+		}
+
+		return s.Sessions.DeleteByUser(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.revokeUserTokens(ctx, userID)
+	return nil
+}
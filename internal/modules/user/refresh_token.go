@@ -2,160 +2,146 @@ package user
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
-	"github.com/google/uuid"
-	"github.com/sonyarianto/gobete/internal/systems/db"
 	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+	"github.com/sonyarianto/gobete/internal/systems/token"
 
-	"os"
-	"strconv"
-	"time"
+	"context"
+	"errors"
 )
 
-func RefreshTokenHandler(c *fiber.Ctx) error {
-	// Get refresh token from cookie
-	refreshTokenString := c.Cookies("refresh_token")
+// errRefreshTokenReused is returned when the session of a refresh token was already rotated
+var errRefreshTokenReused = errors.New("refresh token already used")
+
+func (s *Service) RefreshTokenHandler(c *fiber.Ctx) error {
+	// Get refresh token from the cookie or the X-Refresh-Token header, depending on the client type
+	refreshTokenString := s.RefreshTokenFromRequest(c)
 	if refreshTokenString == "" {
 		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "no_refresh_token")
 	}
 
 	// Parse and validate the refresh token
-	token, err := jwt.Parse(refreshTokenString, func(token *jwt.Token) (any, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fiber.NewError(fiber.StatusUnauthorized, "unexpected_signing_method")
-		}
-		return jwtSecret, nil
-	})
-	if err != nil || !token.Valid {
+	claims, err := s.Tokens.ParseRefreshToken(refreshTokenString)
+	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_refresh_token")
 	}
+	userID := claims.UserID
+	jti := claims.ID
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_refresh_token_claims")
+	// Check if the refresh token was revoked. In stateful mode the session table decides,
+	// so only single revoked tokens are checked, the user watermark applies to stateless mode.
+	revoked, err := s.Revocations.IsTokenRevoked(c.UserContext(), jti)
+	if err == nil && !revoked && !s.Config.Session.Stateful() {
+		revoked, err = revocation.IsRevoked(c.UserContext(), s.Revocations, claims)
 	}
-
-	// Extract user_id and jti
-	userIDFloat, ok := claims["user_id"].(float64)
-	if !ok {
-		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_user_id")
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to check token revocation")
 	}
-	userID := uint(userIDFloat)
-
-	jti, ok := claims["jti"].(string)
-	if !ok {
-		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_jti")
+	if revoked {
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "invalid_refresh_token")
 	}
 
-	// Check session mode
-	sessionMode := os.Getenv("SESSION_MODE")
-	if sessionMode == "jwt_server_stateful" {
-		// Check if session exists and is valid
-		var session UserSession
-		err := db.DB.Where("user_id = ? AND jti = ? AND expires_at > ?", userID, jti, time.Now()).First(&session).Error
-		if err != nil {
+	// Check if session exists and is valid
+	session := &UserSession{}
+	if s.Config.Session.Stateful() {
+		session, err = s.Sessions.FindByJTI(c.UserContext(), jti)
+		if err != nil || session.UserID != userID || !session.ExpiresAt.After(s.Clock()) {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "refresh_session_not_found")
 		}
-
-		// Delete old session (rotation)
-		db.DB.Delete(&session)
 	}
 
 	// Fetch user and user detail
-	var user User
-	if err := db.DB.Select("id, email").Where("id = ?", userID).First(&user).Error; err != nil {
+	user, err := s.Users.FindByID(c.UserContext(), userID)
+	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "user_not_found")
 	}
-	var userDetail UserDetail
-	if err := db.DB.Select("id, first_name, last_name, user_id").Where("user_id = ?", user.ID).First(&userDetail).Error; err != nil {
+	userDetail, err := s.Users.FindDetail(c.UserContext(), user.ID)
+	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "user_detail_not_found")
 	}
 
-	// Generate new access token
-	accessTokenExpireMinutes := os.Getenv("ACCESS_TOKEN_EXPIRE_MINUTES")
-	accessTokenExpire := 15
-	if accessTokenExpireMinutes != "" {
-		if v, err := strconv.Atoi(accessTokenExpireMinutes); err == nil {
-			accessTokenExpire = v
-		}
+	// Fetch roles and permissions, so role changes take effect on refresh
+	roles, permissions, err := s.GetUserRolesAndPermissions(c.UserContext(), user.ID)
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user roles")
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Duration(accessTokenExpire) * time.Minute).Unix(),
-		"iat":     time.Now().Unix(),
-		"jti":     uuid.NewString(),
+
+	// Generate new access token
+	accessTokenString, _, err := s.Tokens.IssueAccessToken(token.Claims{
+		UserID:        user.ID,
+		Email:         user.Email,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: user.EmailVerifiedAt != nil,
 	})
-	accessTokenString, err := accessToken.SignedString(jwtSecret)
 	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate access token")
 	}
 
 	// Generate new refresh token
-	refreshTokenExpireDays := os.Getenv("REFRESH_TOKEN_EXPIRE_DAYS")
-	refreshTokenExpire := 7
-	if refreshTokenExpireDays != "" {
-		if v, err := strconv.Atoi(refreshTokenExpireDays); err == nil {
-			refreshTokenExpire = v
-		}
-	}
-	newRefreshJTI := uuid.NewString()
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": user.ID,
-		"email":   user.Email,
-		"exp":     time.Now().Add(time.Duration(refreshTokenExpire) * 24 * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
-		"jti":     newRefreshJTI,
-	})
-	newRefreshTokenString, err := refreshToken.SignedString(jwtSecret)
+	newRefreshTokenString, refreshClaims, err := s.Tokens.IssueRefreshToken(token.Claims{UserID: user.ID, Email: user.Email})
 	if err != nil {
 		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "internal_error", "Failed to generate refresh token")
 	}
 
-	// Store new session if stateful
-	if sessionMode == "jwt_server_stateful" {
-		claims := refreshToken.Claims.(jwt.MapClaims)
-		issuedAt, _ := claims["iat"].(int64)
-		if issuedAt == 0 {
-			if f, ok := claims["iat"].(float64); ok {
-				issuedAt = int64(f)
+	// Replace the session if stateful. The old session is marked as rotated, a refresh token is exchanged
+	// only once, in the same transaction that creates the new one, so a failed refresh can be retried.
+	if s.Config.Session.Stateful() {
+		err = s.Transaction(c.UserContext(), func(ctx context.Context) error {
+			rotated, err := s.Sessions.Rotate(ctx, session.ID, s.Clock())
+			if err != nil {
+				return err
 			}
-		}
-		expiresAt, _ := claims["exp"].(int64)
-		if expiresAt == 0 {
-			if f, ok := claims["exp"].(float64); ok {
-				expiresAt = int64(f)
+			if !rotated {
+				return errRefreshTokenReused
 			}
+
+			return s.Sessions.Create(ctx, &UserSession{
+				UserID:     user.ID,
+				JTI:        refreshClaims.ID,
+				FamilyID:   session.FamilyID, // Same rotation family as the old session
+				ParentID:   &session.ID,
+				Label:      session.Label,
+				UserAgent:  c.Get(fiber.HeaderUserAgent),
+				IPAddress:  c.IP(),
+				CreatedAt:  refreshClaims.IssuedAt.Time,
+				ExpiresAt:  refreshClaims.ExpiresAt.Time,
+				LastSeenAt: refreshClaims.IssuedAt.Time,
+			})
+		})
+
+		// An already rotated refresh token was presented again, it was most likely stolen.
+		// Revoke the entire family, so neither the attacker nor the victim can keep using it.
+		if err == errRefreshTokenReused {
+			if err := s.Sessions.DeleteFamily(c.UserContext(), session.FamilyID); err != nil {
+				return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to revoke user sessions")
+			}
+			s.recordSecurityEvent(c, userID, SecurityEventRefreshTokenReuse, session.FamilyID)
+
+			// Access tokens issued to the attacker may still be alive, revoke them all
+			s.revokeUserTokens(c.UserContext(), userID)
+
+			s.clearRefreshTokenCookie(c)
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "refresh_token_reused")
 		}
-		session := UserSession{
-			UserID:     user.ID,
-			JTI:        newRefreshJTI,
-			CreatedAt:  time.Unix(issuedAt, 0),
-			ExpiresAt:  time.Unix(expiresAt, 0),
-			LastSeenAt: time.Unix(issuedAt, 0),
-		}
-		if err := db.DB.Create(&session).Error; err != nil {
-			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to create user session")
+		if err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to rotate user session")
 		}
 	}
 
-	// Set new refresh token as HttpOnly cookie
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    newRefreshTokenString,
-		HTTPOnly: true,
-		SameSite: fiber.CookieSameSiteLaxMode,
-		Expires:  time.Now().Add(time.Duration(refreshTokenExpire) * 24 * time.Hour),
-		Secure:   os.Getenv("ENV") == "production", // Only send cookie over HTTPS in production
-		Path:     "/",
-	})
-
 	// Return success response with new access token
-	return response.SendSuccessResponse(c, "Token refreshed successfully", fiber.Map{
-		"id":           user.ID,
-		"first_name":   userDetail.FirstName,
-		"last_name":    userDetail.LastName,
-		"email":        user.Email,
-		"access_token": accessTokenString,
-	})
+	data := fiber.Map{
+		"id":             user.ID,
+		"first_name":     userDetail.FirstName,
+		"last_name":      userDetail.LastName,
+		"email":          user.Email,
+		"roles":          roles,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"access_token":   accessTokenString,
+	}
+
+	// Hand out the new refresh token as HttpOnly cookie or in the response body
+	s.sendRefreshToken(c, data, newRefreshTokenString, refreshClaims.ExpiresAt.Time)
+
+	return response.SendSuccessResponse(c, "Token refreshed successfully", data)
 }
@@ -0,0 +1,89 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"github.com/sonyarianto/gobete/internal/systems/migrate"
+
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// newTestGormService is newTestService on the GORM repositories and a migrated SQLite database, for
+// tests that need transactions to roll back
+func newTestGormService(t *testing.T) *Service {
+	t.Helper()
+
+	database, err := db.Connect(config.DBConfig{Driver: db.SQLite, Name: filepath.Join(t.TempDir(), "gobete.db"), ConnectRetryDelaySeconds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+
+	migrator, err := migrate.New(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestService(t)
+	s.DB = database
+	s.Repositories = NewGormRepositories(database)
+	return s
+}
+
+// failingSessions fails creating sessions while fail is set
+type failingSessions struct {
+	SessionRepository
+	fail bool
+}
+
+func (r *failingSessions) Create(ctx context.Context, session *UserSession) error {
+	if r.fail {
+		return errors.New("database is gone")
+	}
+	return r.SessionRepository.Create(ctx, session)
+}
+
+func TestRefreshRetryAfterFailedRotation(t *testing.T) {
+	s := newTestGormService(t)
+	sessions := &failingSessions{SessionRepository: s.Sessions}
+	s.Sessions = sessions
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login status = %d (%s), want 200", res.Status, res.Code)
+	}
+	refreshToken, _ := res.Data["refresh_token"].(string)
+
+	// The new session is not stored, the old one must not stay rotated
+	sessions.fail = true
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusInternalServerError {
+		t.Fatalf("refresh with a failing database = %d (%s), want 500", res.Status, res.Code)
+	}
+
+	// The client retries with the same refresh token, which is not a reuse
+	sessions.fail = false
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("retried refresh = %d (%s), want 200", res.Status, res.Code)
+	}
+
+	// Once rotated, presenting it again is a reuse
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusUnauthorized || res.Code != "refresh_token_reused" {
+		t.Errorf("reused refresh = %d (%s), want 401 refresh_token_reused", res.Status, res.Code)
+	}
+}
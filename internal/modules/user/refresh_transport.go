@@ -0,0 +1,108 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"strings"
+	"time"
+)
+
+// Client types, sent by the client in the X-Client-Type header. Requests without it are "web".
+const (
+	ClientTypeWeb    = "web"
+	ClientTypeMobile = "mobile"
+)
+
+// Refresh token transports
+const (
+	RefreshTransportCookie = "cookie" // HttpOnly cookie, for browsers
+	RefreshTransportBody   = "body"   // JSON body of login and refresh responses, X-Refresh-Token header on requests
+)
+
+// clientType returns the client type of the request
+func clientType(c *fiber.Ctx) string {
+	if t := strings.ToLower(strings.TrimSpace(c.Get("X-Client-Type"))); t != "" {
+		return t
+	}
+	return ClientTypeWeb
+}
+
+// refreshTokenTransport returns the refresh token transport of the request client type. The policy is set with
+// REFRESH_TOKEN_TRANSPORTS as comma separated type:transport pairs, the default is "web:cookie,mobile:body".
+// Unknown client types are treated as web, so a browser can never opt out of the HttpOnly cookie.
+func (s *Service) refreshTokenTransport(c *fiber.Ctx) string {
+	transports := s.Config.Session.RefreshTokenTransports
+	if transport, ok := transports[clientType(c)]; ok {
+		return transport
+	}
+	if transport, ok := transports[ClientTypeWeb]; ok {
+		return transport
+	}
+	return RefreshTransportCookie
+}
+
+// RefreshTokenFromRequest returns the refresh token sent with the transport of the client type, or an empty
+// string. A token is only read from its own transport, so a script in a browser cannot read the cookie token
+// by switching client type.
+func (s *Service) RefreshTokenFromRequest(c *fiber.Ctx) string {
+	if s.refreshTokenTransport(c) == RefreshTransportCookie {
+		return c.Cookies("refresh_token")
+	}
+
+	if refreshTokenString := c.Get("X-Refresh-Token"); refreshTokenString != "" {
+		return refreshTokenString
+	}
+
+	// Fallback to the request body, e.g. {"refresh_token": "..."} on refresh and logout
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if c.Is("json") && c.BodyParser(&body) == nil {
+		return body.RefreshToken
+	}
+	return ""
+}
+
+// sendRefreshToken hands the refresh token to the client, as HttpOnly cookie or in the response data
+func (s *Service) sendRefreshToken(c *fiber.Ctx, data fiber.Map, refreshTokenString string, expires time.Time) {
+	if s.refreshTokenTransport(c) == RefreshTransportCookie {
+		s.setRefreshTokenCookie(c, refreshTokenString, expires)
+		return
+	}
+
+	data["refresh_token"] = refreshTokenString
+	data["refresh_token_expires_at"] = expires
+}
+
+// setRefreshTokenCookie sets the refresh token as HttpOnly cookie
+func (s *Service) setRefreshTokenCookie(c *fiber.Ctx, refreshTokenString string, expires time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshTokenString,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+		Expires:  expires,
+		Secure:   s.Config.App.IsProduction(), // Only send cookie over HTTPS in production
+		Path:     "/",                         // Cookie valid for all paths
+	})
+}
+
+// clearRefreshTokenCookie expires the refresh token cookie immediately. Clients of the body transport
+// drop their stored token themselves when the server answers with an error or a logout.
+func (s *Service) clearRefreshTokenCookie(c *fiber.Ctx) {
+	s.setRefreshTokenCookie(c, "", s.Clock().Add(-time.Hour))
+}
+
+// refreshTokenJTIFromRequest returns the JTI of a valid refresh token of the request, or an empty string
+func (s *Service) refreshTokenJTIFromRequest(c *fiber.Ctx) string {
+	refreshTokenString := s.RefreshTokenFromRequest(c)
+	if refreshTokenString == "" {
+		return ""
+	}
+
+	claims, err := s.Tokens.ParseRefreshToken(refreshTokenString)
+	if err != nil {
+		return ""
+	}
+	return claims.ID
+}
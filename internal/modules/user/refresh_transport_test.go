@@ -0,0 +1,112 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// refreshCookie returns the refresh token cookie set by a response, or an empty string
+func refreshCookie(res testResponse) string {
+	for _, cookie := range (&http.Response{Header: res.Header}).Cookies() {
+		if cookie.Name == "refresh_token" {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func TestWebClientsGetRefreshTokenCookie(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	// Browsers don't send a client type, unknown types are treated the same
+	for _, clientType := range []string{"", ClientTypeWeb, "desktop"} {
+		web := map[string]string{"X-Client-Type": clientType}
+		res := do(t, app, http.MethodPost, "/login", LoginRequest{Email: "jane@example.com", Password: testPassword}, web)
+		if res.Status != fiber.StatusOK {
+			t.Fatalf("client type %q: login = %d (%s), want 200", clientType, res.Status, res.Code)
+		}
+		if _, ok := res.Data["refresh_token"]; ok {
+			t.Errorf("client type %q: login data has the refresh token, want it only in the cookie", clientType)
+		}
+		if !strings.Contains(res.Header.Get(fiber.HeaderSetCookie), "HttpOnly") {
+			t.Errorf("client type %q: Set-Cookie = %q, want an HttpOnly cookie", clientType, res.Header.Get(fiber.HeaderSetCookie))
+		}
+		refreshToken := refreshCookie(res)
+		if refreshToken == "" {
+			t.Fatalf("client type %q: no refresh token cookie", clientType)
+		}
+
+		// A token is only read from the transport of the client type
+		header := map[string]string{"X-Client-Type": clientType, "X-Refresh-Token": refreshToken}
+		if res := do(t, app, http.MethodPost, "/refresh", nil, header); res.Status != fiber.StatusUnauthorized || res.Code != "no_refresh_token" {
+			t.Errorf("client type %q: refresh with the header = %d (%s), want 401 no_refresh_token", clientType, res.Status, res.Code)
+		}
+
+		cookie := map[string]string{"X-Client-Type": clientType, "Cookie": "refresh_token=" + refreshToken}
+		res = do(t, app, http.MethodPost, "/refresh", nil, cookie)
+		if res.Status != fiber.StatusOK {
+			t.Fatalf("client type %q: refresh with the cookie = %d (%s), want 200", clientType, res.Status, res.Code)
+		}
+		if rotated := refreshCookie(res); rotated == "" || rotated == refreshToken {
+			t.Errorf("client type %q: refresh cookie = %q, want a new refresh token", clientType, rotated)
+		}
+	}
+}
+
+func TestMobileClientsGetRefreshTokenInBody(t *testing.T) {
+	s := newTestService(t)
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	res := login(t, app, "jane@example.com", testPassword)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login = %d (%s), want 200", res.Status, res.Code)
+	}
+	refreshToken, _ := res.Data["refresh_token"].(string)
+	if refreshToken == "" || res.Data["refresh_token_expires_at"] == nil {
+		t.Fatalf("login data = %v, want the refresh token and its expiry", res.Data)
+	}
+	if cookie := refreshCookie(res); cookie != "" {
+		t.Errorf("login set the refresh token cookie %q, want none", cookie)
+	}
+
+	// A cookie is not read for mobile clients
+	if res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"Cookie": "refresh_token=" + refreshToken}); res.Status != fiber.StatusUnauthorized || res.Code != "no_refresh_token" {
+		t.Errorf("refresh with a cookie = %d (%s), want 401 no_refresh_token", res.Status, res.Code)
+	}
+
+	// The token is sent in the X-Refresh-Token header or in the JSON body
+	res = do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": refreshToken})
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("refresh with the header = %d (%s), want 200", res.Status, res.Code)
+	}
+	refreshToken, _ = res.Data["refresh_token"].(string)
+	res = do(t, app, http.MethodPost, "/refresh", map[string]string{"refresh_token": refreshToken}, nil)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("refresh with the body = %d (%s), want 200", res.Status, res.Code)
+	}
+	if rotated, _ := res.Data["refresh_token"].(string); rotated == "" || rotated == refreshToken {
+		t.Errorf("refresh data = %v, want a new refresh token", res.Data)
+	}
+}
+
+func TestRefreshTokenTransportsConfig(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Session.RefreshTokenTransports = map[string]string{ClientTypeWeb: RefreshTransportBody, ClientTypeMobile: RefreshTransportCookie}
+	app := newTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	res := do(t, app, http.MethodPost, "/login", LoginRequest{Email: "jane@example.com", Password: testPassword}, map[string]string{"X-Client-Type": ""})
+	if _, ok := res.Data["refresh_token"].(string); !ok || refreshCookie(res) != "" {
+		t.Errorf("web login with the body transport = %v, cookie %q, want the token in the body only", res.Data, refreshCookie(res))
+	}
+	res = login(t, app, "jane@example.com", testPassword)
+	if _, ok := res.Data["refresh_token"]; ok || refreshCookie(res) == "" {
+		t.Errorf("mobile login with the cookie transport = %v, cookie %q, want the token in the cookie only", res.Data, refreshCookie(res))
+	}
+}
@@ -0,0 +1,212 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned by the repositories when no record matches
+var ErrNotFound = errors.New("record not found")
+
+// Repositories are the storage of the user module. Handlers only talk to the database through them,
+// so the module runs on the GORM implementations in production and on the in-memory ones in tests.
+type Repositories struct {
+	Transactor
+	Users               UserRepository
+	Sessions            SessionRepository
+	Roles               RoleRepository
+	LoginThrottles      LoginThrottleRepository
+	MFA                 MFARepository
+	PasswordResetTokens PasswordResetTokenRepository
+	VerificationTokens  EmailVerificationTokenRepository
+	OAuth               OAuthRepository
+	APIKeys             APIKeyRepository
+	SecurityEvents      SecurityEventRepository
+}
+
+// Transactor runs writes spanning several repositories atomically
+type Transactor interface {
+	// Transaction runs fn in a transaction. Repository calls made with the context passed to fn take
+	// part in it, the transaction is rolled back if fn returns an error.
+	Transaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// UserDetailUpdate holds the profile fields to change, nil fields are left as they are
+type UserDetailUpdate struct {
+	FirstName *string
+	LastName  *string
+	Phone     *string
+	Bio       *string
+	AvatarURL *string
+}
+
+// UserRepository stores users and their details
+type UserRepository interface {
+	// Create stores a new user and sets its ID
+	Create(ctx context.Context, user *User) error
+	// CreateDetail stores the profile of a new user
+	CreateDetail(ctx context.Context, detail *UserDetail) error
+	// FindByID returns the user with the given ID, soft deleted users are not found
+	FindByID(ctx context.Context, id uint) (*User, error)
+	// FindByEmail returns the user with the given email, soft deleted users are not found
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	// FindDetail returns the profile of the user
+	FindDetail(ctx context.Context, userID uint) (*UserDetail, error)
+	// FindResponse returns the admin view of a user, optionally also a soft deleted one. Roles are not set.
+	FindResponse(ctx context.Context, id uint, includeDeleted bool) (*UserResponse, error)
+	// List returns a page of the admin user list and the total number of matching users. Roles are not set.
+	List(ctx context.Context, query ListUsersQuery) ([]UserResponse, int64, error)
+	// EmailExists reports whether the email is used, optionally also by soft deleted users
+	EmailExists(ctx context.Context, email string, includeDeleted bool) (bool, error)
+	// UpdateDetail changes the profile fields set in the update
+	UpdateDetail(ctx context.Context, userID uint, update UserDetailUpdate) error
+	// UpdateEmail changes the email of the user, which has to be verified again
+	UpdateEmail(ctx context.Context, userID uint, email string) error
+	// UpdatePassword replaces the password hash of the user, ErrNotFound if the user does not exist
+	UpdatePassword(ctx context.Context, userID uint, passwordHash string) error
+	// MarkEmailVerified sets the email verification time, unless the email is already verified
+	MarkEmailVerified(ctx context.Context, userID uint, at time.Time) error
+	// Delete soft deletes the user, ErrNotFound if the user does not exist
+	Delete(ctx context.Context, userID uint) error
+}
+
+// SessionRepository stores the refresh token sessions of the stateful session mode.
+// Every refresh rotates a session into a new one of the same family.
+type SessionRepository interface {
+	// Create stores a new session and sets its ID
+	Create(ctx context.Context, session *UserSession) error
+	// FindByID returns a session of the user
+	FindByID(ctx context.Context, userID uint, id uint) (*UserSession, error)
+	// FindByJTI returns the session of a refresh token, including rotated and expired ones. It reads from
+	// the primary database, a replica may not have the rotation of a concurrent refresh yet.
+	FindByJTI(ctx context.Context, jti string) (*UserSession, error)
+	// ListActive returns the latest session of every family of the user that did not expire, most recently seen first
+	ListActive(ctx context.Context, userID uint, now time.Time) ([]UserSession, error)
+	// Rotate marks the session as rotated, it reports false if it already was
+	Rotate(ctx context.Context, id uint, at time.Time) (bool, error)
+	// Touch updates the last seen time and IP address of the session
+	Touch(ctx context.Context, id uint, at time.Time, ip string) error
+	// DeleteFamily deletes every session of a rotation family
+	DeleteFamily(ctx context.Context, familyID string) error
+	// DeleteOtherFamilies deletes every session of the user outside of the given family
+	DeleteOtherFamilies(ctx context.Context, userID uint, keepFamilyID string) error
+	// DeleteByUser deletes every session of the user
+	DeleteByUser(ctx context.Context, userID uint) error
+}
+
+// RoleRepository stores the roles, their permissions and the roles of every user
+type RoleRepository interface {
+	// Seed creates the roles and permissions that do not exist yet and grants the permissions to the roles
+	Seed(ctx context.Context, rolePermissions map[string][]string) error
+	// FindByNames returns the existing roles of the given names
+	FindByNames(ctx context.Context, names []string) ([]Role, error)
+	// FindByUser returns the roles of the user with their permissions
+	FindByUser(ctx context.Context, userID uint) ([]Role, error)
+	// NamesByUser returns the role names of every given user
+	NamesByUser(ctx context.Context, userIDs []uint) (map[uint][]string, error)
+	// Assign grants the named role to the user, creating the role if it does not exist yet
+	Assign(ctx context.Context, userID uint, roleName string) error
+	// Replace sets the roles of the user
+	Replace(ctx context.Context, userID uint, roles []Role) error
+}
+
+// LoginThrottleRepository stores the failed login counters of emails and client IPs
+type LoginThrottleRepository interface {
+	// FindLocked returns the throttles of the keys that are locked after now
+	FindLocked(ctx context.Context, keys []string, now time.Time) ([]LoginThrottle, error)
+	// FindForUpdate returns the throttle of the key, locked until the end of the transaction of ctx
+	FindForUpdate(ctx context.Context, key string) (*LoginThrottle, error)
+	// Save creates or updates a throttle
+	Save(ctx context.Context, throttle *LoginThrottle) error
+	// Delete forgets the failures of the key
+	Delete(ctx context.Context, key string) error
+}
+
+// MFARepository stores the TOTP second factors and the recovery codes
+type MFARepository interface {
+	// Find returns the second factor of the user, confirmed or not
+	Find(ctx context.Context, userID uint) (*UserMFA, error)
+	// FindEnabled returns the confirmed second factor of the user
+	FindEnabled(ctx context.Context, userID uint) (*UserMFA, error)
+	// Create stores a new, not yet confirmed second factor
+	Create(ctx context.Context, mfa *UserMFA) error
+	// Enable confirms the second factor with the time step of the first accepted code
+	Enable(ctx context.Context, id uint, at time.Time, step int64) error
+	// UseStep accepts a TOTP time step, it reports false if the step is not newer than the last accepted one
+	UseStep(ctx context.Context, id uint, step int64) (bool, error)
+	// Delete removes the second factor and the recovery codes of the user
+	Delete(ctx context.Context, userID uint) error
+	// ReplaceRecoveryCodes replaces the recovery codes of the user with the given hashes, created at the given time
+	ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string, at time.Time) error
+	// UseRecoveryCode marks an unused recovery code as used, it reports false if there is none
+	UseRecoveryCode(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error)
+}
+
+// PasswordResetTokenRepository stores the one-time password reset tokens
+type PasswordResetTokenRepository interface {
+	// Create stores a new token
+	Create(ctx context.Context, token *PasswordResetToken) error
+	// FindValid returns the unused token of the hash that did not expire at now, from the primary database
+	FindValid(ctx context.Context, tokenHash string, now time.Time) (*PasswordResetToken, error)
+	// Use marks the token as used, it reports false if it already was
+	Use(ctx context.Context, id uint, at time.Time) (bool, error)
+	// DeleteUnused deletes the unused tokens of the user
+	DeleteUnused(ctx context.Context, userID uint) error
+}
+
+// EmailVerificationTokenRepository stores the one-time email verification tokens
+type EmailVerificationTokenRepository interface {
+	// Create stores a new token
+	Create(ctx context.Context, token *EmailVerificationToken) error
+	// FindValid returns the unused token of the hash that did not expire at now, from the primary database
+	FindValid(ctx context.Context, tokenHash string, now time.Time) (*EmailVerificationToken, error)
+	// Use marks the token as used, it reports false if it already was
+	Use(ctx context.Context, id uint, at time.Time) (bool, error)
+	// DeleteUnused deletes the unused tokens of the user
+	DeleteUnused(ctx context.Context, userID uint) error
+	// CountCreatedAfter counts the tokens of the user created after the given time
+	CountCreatedAfter(ctx context.Context, userID uint, after time.Time) (int64, error)
+}
+
+// OAuthRepository stores the pending authorization requests and the linked provider identities
+type OAuthRepository interface {
+	// CreateState stores a pending authorization request
+	CreateState(ctx context.Context, state *OAuthState) error
+	// FindState returns the pending request of the state hash and provider that did not expire at now, from the
+	// primary database, the provider redirects back faster than a replica may catch up
+	FindState(ctx context.Context, stateHash string, provider string, now time.Time) (*OAuthState, error)
+	// DeleteState deletes a pending request, it reports false if it was already deleted
+	DeleteState(ctx context.Context, id uint) (bool, error)
+	// FindIdentity returns the identity of the provider subject
+	FindIdentity(ctx context.Context, provider string, subject string) (*UserIdentity, error)
+	// ListIdentities returns the identities of the user, oldest first
+	ListIdentities(ctx context.Context, userID uint) ([]UserIdentity, error)
+	// CreateIdentity links a new identity
+	CreateIdentity(ctx context.Context, identity *UserIdentity) error
+	// TouchIdentity updates the provider email and the last login time of the identity
+	TouchIdentity(ctx context.Context, id uint, email string, at time.Time) error
+	// DeleteIdentity unlinks an identity of the user, it reports false if there is none
+	DeleteIdentity(ctx context.Context, userID uint, id uint) (bool, error)
+}
+
+// APIKeyRepository stores the personal API keys
+type APIKeyRepository interface {
+	// Create stores a new key and sets its ID
+	Create(ctx context.Context, key *APIKey) error
+	// FindByHash returns the key of the hash, including expired ones, from the primary database so a revoked
+	// key stops working right away
+	FindByHash(ctx context.Context, keyHash string) (*APIKey, error)
+	// ListByUser returns the keys of the user, oldest first
+	ListByUser(ctx context.Context, userID uint) ([]APIKey, error)
+	// Touch updates the last used time and IP address of the key
+	Touch(ctx context.Context, id uint, at time.Time, ip string) error
+	// Delete revokes a key of the user, it reports false if there is none
+	Delete(ctx context.Context, userID uint, id uint) (bool, error)
+}
+
+// SecurityEventRepository stores the audit trail of security relevant events
+type SecurityEventRepository interface {
+	// Create stores an event
+	Create(ctx context.Context, event *SecurityEvent) error
+}
@@ -0,0 +1,651 @@
+package user
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Allowed sort keys for the admin user list, mapped to their columns
+var userSortColumns = map[string]string{
+	"id":         "users.id",
+	"email":      "users.email",
+	"created_at": "users.created_at",
+	"first_name": "user_details.first_name",
+	"last_name":  "user_details.last_name",
+}
+
+type gormTxKey struct{}
+
+// NewGormRepositories creates the repositories of the user module on top of the database
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Transactor:          &gormTransactor{db: db},
+		Users:               NewGormUserRepository(db),
+		Sessions:            NewGormSessionRepository(db),
+		Roles:               &gormRoleRepository{db: db},
+		LoginThrottles:      &gormLoginThrottleRepository{db: db},
+		MFA:                 &gormMFARepository{db: db},
+		PasswordResetTokens: &gormPasswordResetTokenRepository{db: db},
+		VerificationTokens:  &gormEmailVerificationTokenRepository{db: db},
+		OAuth:               &gormOAuthRepository{db: db},
+		APIKeys:             &gormAPIKeyRepository{db: db},
+		SecurityEvents:      &gormSecurityEventRepository{db: db},
+	}
+}
+
+type gormTransactor struct {
+	db *gorm.DB
+}
+
+func (t *gormTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	return conn(ctx, t.db).Transaction(func(tx *gorm.DB) error {
+		return fn(context.WithValue(ctx, gormTxKey{}, tx))
+	})
+}
+
+// conn returns the transaction of the context, or the database bound to the context
+func conn(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if tx, ok := ctx.Value(gormTxKey{}).(*gorm.DB); ok {
+		return tx
+	}
+	return db.WithContext(ctx)
+}
+
+type gormUserRepository struct {
+	db *gorm.DB
+}
+
+// NewGormUserRepository creates a user repository on top of the users and user_details tables
+func NewGormUserRepository(db *gorm.DB) UserRepository {
+	return &gormUserRepository{db: db}
+}
+
+func (r *gormUserRepository) Create(ctx context.Context, user *User) error {
+	return conn(ctx, r.db).Create(user).Error
+}
+
+func (r *gormUserRepository) CreateDetail(ctx context.Context, detail *UserDetail) error {
+	return conn(ctx, r.db).Create(detail).Error
+}
+
+func (r *gormUserRepository) FindByID(ctx context.Context, id uint) (*User, error) {
+	var user User
+	if err := conn(ctx, r.db).Where("id = ?", id).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	var user User
+	if err := conn(ctx, r.db).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *gormUserRepository) FindDetail(ctx context.Context, userID uint) (*UserDetail, error) {
+	var userDetail UserDetail
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).First(&userDetail).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &userDetail, nil
+}
+
+// responseQuery returns a query over users joined with their details, selecting the UserResponse columns
+func (r *gormUserRepository) responseQuery(ctx context.Context, includeDeleted bool) *gorm.DB {
+	query := conn(ctx, r.db).Model(&User{}).
+		Select("users.id, users.email, users.email_verified_at, users.created_at, users.updated_at, users.deleted_at, " +
+			"user_details.first_name, user_details.last_name, user_details.phone, user_details.bio, user_details.avatar_url").
+		Joins("LEFT JOIN user_details ON user_details.user_id = users.id")
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+	return query
+}
+
+func (r *gormUserRepository) FindResponse(ctx context.Context, id uint, includeDeleted bool) (*UserResponse, error) {
+	var users []UserResponse
+	if err := r.responseQuery(ctx, includeDeleted).Where("users.id = ?", id).Limit(1).Scan(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, ErrNotFound
+	}
+	return &users[0], nil
+}
+
+// likeEscaper escapes the LIKE wildcards with '!', a character no database treats specially in string
+// literals, unlike the backslash on MySQL
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// containsPattern is the LIKE pattern matching the lowercase text anywhere
+func containsPattern(text string) string {
+	return "%" + likeEscaper.Replace(strings.ToLower(text)) + "%"
+}
+
+func (r *gormUserRepository) List(ctx context.Context, query ListUsersQuery) ([]UserResponse, int64, error) {
+	q := r.responseQuery(ctx, query.IncludeDeleted)
+
+	// Filters, case insensitive on every database (LIKE is case sensitive on PostgreSQL). They match the
+	// text literally, like the memory repository, % and _ are not wildcards.
+	if query.Email != "" {
+		q = q.Where("LOWER(users.email) LIKE ? ESCAPE '!'", containsPattern(query.Email))
+	}
+	if query.Name != "" {
+		name := containsPattern(query.Name)
+		q = q.Where("LOWER(user_details.first_name) LIKE ? ESCAPE '!' OR LOWER(user_details.last_name) LIKE ? ESCAPE '!'", name, name)
+	}
+	if query.CreatedFrom != "" {
+		createdFrom, _ := time.ParseInLocation("2006-01-02", query.CreatedFrom, time.Local) // Already validated
+		q = q.Where("users.created_at >= ?", createdFrom)
+	}
+	if query.CreatedTo != "" {
+		createdTo, _ := time.ParseInLocation("2006-01-02", query.CreatedTo, time.Local) // Already validated
+		q = q.Where("users.created_at < ?", createdTo.AddDate(0, 0, 1))                 // Inclusive of the whole day
+	}
+
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Sorting, "-" prefix means descending
+	sort, direction := strings.TrimPrefix(query.Sort, "-"), "ASC"
+	if strings.HasPrefix(query.Sort, "-") {
+		direction = "DESC"
+	}
+	q = q.Order(userSortColumns[sort] + " " + direction).Order("users.id " + direction)
+
+	users := []UserResponse{}
+	if err := q.Offset((query.Page - 1) * query.PerPage).Limit(query.PerPage).Scan(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (r *gormUserRepository) EmailExists(ctx context.Context, email string, includeDeleted bool) (bool, error) {
+	query := conn(ctx, r.db).Model(&User{})
+	if includeDeleted {
+		query = query.Unscoped()
+	}
+	var count int64
+	err := query.Where("email = ?", email).Count(&count).Error
+	return count > 0, err
+}
+
+func (r *gormUserRepository) UpdateDetail(ctx context.Context, userID uint, update UserDetailUpdate) error {
+	// Only update the fields that are set
+	updates := map[string]any{}
+	if update.FirstName != nil {
+		updates["first_name"] = *update.FirstName
+	}
+	if update.LastName != nil {
+		updates["last_name"] = *update.LastName
+	}
+	if update.Phone != nil {
+		updates["phone"] = *update.Phone
+	}
+	if update.Bio != nil {
+		updates["bio"] = *update.Bio
+	}
+	if update.AvatarURL != nil {
+		updates["avatar_url"] = *update.AvatarURL
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return conn(ctx, r.db).Model(&UserDetail{}).Where("user_id = ?", userID).Updates(updates).Error
+}
+
+func (r *gormUserRepository) UpdateEmail(ctx context.Context, userID uint, email string) error {
+	return conn(ctx, r.db).Model(&User{}).Where("id = ?", userID).
+		Updates(map[string]any{"email": email, "email_verified_at": nil}).Error
+}
+
+func (r *gormUserRepository) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	result := conn(ctx, r.db).Model(&User{}).Where("id = ?", userID).Update("password", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormUserRepository) MarkEmailVerified(ctx context.Context, userID uint, at time.Time) error {
+	return conn(ctx, r.db).Model(&User{}).
+		Where("id = ? AND email_verified_at IS NULL", userID).
+		Update("email_verified_at", at).Error
+}
+
+func (r *gormUserRepository) Delete(ctx context.Context, userID uint) error {
+	result := conn(ctx, r.db).Delete(&User{}, userID) // Sets DeletedAt, because User embeds gorm.Model
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormSessionRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSessionRepository creates a session repository on top of the user_sessions table
+func NewGormSessionRepository(db *gorm.DB) SessionRepository {
+	return &gormSessionRepository{db: db}
+}
+
+func (r *gormSessionRepository) Create(ctx context.Context, session *UserSession) error {
+	return conn(ctx, r.db).Create(session).Error
+}
+
+func (r *gormSessionRepository) FindByID(ctx context.Context, userID uint, id uint) (*UserSession, error) {
+	var session UserSession
+	if err := conn(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).First(&session).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) FindByJTI(ctx context.Context, jti string) (*UserSession, error) {
+	var session UserSession
+	if err := conn(db.Primary(ctx), r.db).Where("jti = ?", jti).First(&session).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *gormSessionRepository) ListActive(ctx context.Context, userID uint, now time.Time) ([]UserSession, error) {
+	var sessions []UserSession
+	err := conn(ctx, r.db).
+		Where("user_id = ? AND rotated_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+func (r *gormSessionRepository) Rotate(ctx context.Context, id uint, at time.Time) (bool, error) {
+	// The condition makes sure a session is rotated only once, even by concurrent requests
+	result := conn(ctx, r.db).Model(&UserSession{}).
+		Where("id = ? AND rotated_at IS NULL", id).
+		Update("rotated_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormSessionRepository) Touch(ctx context.Context, id uint, at time.Time, ip string) error {
+	return conn(ctx, r.db).Model(&UserSession{ID: id}).Updates(map[string]any{
+		"last_seen_at": at,
+		"ip_address":   ip,
+	}).Error
+}
+
+func (r *gormSessionRepository) DeleteFamily(ctx context.Context, familyID string) error {
+	return conn(ctx, r.db).Where("family_id = ?", familyID).Delete(&UserSession{}).Error
+}
+
+func (r *gormSessionRepository) DeleteOtherFamilies(ctx context.Context, userID uint, keepFamilyID string) error {
+	return conn(ctx, r.db).Where("user_id = ? AND family_id <> ?", userID, keepFamilyID).Delete(&UserSession{}).Error
+}
+
+func (r *gormSessionRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Where("user_id = ?", userID).Delete(&UserSession{}).Error
+}
+
+type gormRoleRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormRoleRepository) Seed(ctx context.Context, rolePermissions map[string][]string) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		for roleName, permissionNames := range rolePermissions {
+			role, err := findOrCreateRole(tx, roleName)
+			if err != nil {
+				return err
+			}
+
+			var permissions []Permission
+			for _, permissionName := range permissionNames {
+				permission := Permission{Name: permissionName}
+				if err := tx.Where("name = ?", permissionName).FirstOrCreate(&permission).Error; err != nil {
+					return err
+				}
+				permissions = append(permissions, permission)
+			}
+
+			if err := tx.Model(&role).Association("Permissions").Append(permissions); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *gormRoleRepository) FindByNames(ctx context.Context, names []string) ([]Role, error) {
+	var roles []Role
+	err := conn(ctx, r.db).Where("name IN ?", names).Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoleRepository) FindByUser(ctx context.Context, userID uint) ([]Role, error) {
+	var roles []Role
+	err := conn(ctx, r.db).Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Find(&roles).Error
+	return roles, err
+}
+
+func (r *gormRoleRepository) NamesByUser(ctx context.Context, userIDs []uint) (map[uint][]string, error) {
+	var rows []struct {
+		UserID uint
+		Name   string
+	}
+	err := conn(ctx, r.db).Table("user_roles").
+		Select("user_roles.user_id, roles.name").
+		Joins("JOIN roles ON roles.id = user_roles.role_id").
+		Where("user_roles.user_id IN ?", userIDs).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rolesByUser := map[uint][]string{}
+	for _, row := range rows {
+		rolesByUser[row.UserID] = append(rolesByUser[row.UserID], row.Name)
+	}
+	return rolesByUser, nil
+}
+
+func (r *gormRoleRepository) Assign(ctx context.Context, userID uint, roleName string) error {
+	tx := conn(ctx, r.db)
+	role, err := findOrCreateRole(tx, roleName)
+	if err != nil {
+		return err
+	}
+
+	return tx.Model(&User{Model: gorm.Model{ID: userID}}).Association("Roles").Append(&role)
+}
+
+func (r *gormRoleRepository) Replace(ctx context.Context, userID uint, roles []Role) error {
+	return conn(ctx, r.db).Model(&User{Model: gorm.Model{ID: userID}}).Association("Roles").Replace(roles)
+}
+
+func findOrCreateRole(tx *gorm.DB, roleName string) (Role, error) {
+	role := Role{Name: roleName}
+	err := tx.Where("name = ?", roleName).FirstOrCreate(&role).Error
+	return role, err
+}
+
+type gormLoginThrottleRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormLoginThrottleRepository) FindLocked(ctx context.Context, keys []string, now time.Time) ([]LoginThrottle, error) {
+	var throttles []LoginThrottle
+	err := conn(ctx, r.db).
+		Where("throttle_key IN ? AND locked_until > ?", keys, now).
+		Find(&throttles).Error
+	return throttles, err
+}
+
+func (r *gormLoginThrottleRepository) FindForUpdate(ctx context.Context, key string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	err := conn(ctx, r.db).Clauses(clause.Locking{Strength: "UPDATE"}).Where("throttle_key = ?", key).First(&throttle).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &throttle, nil
+}
+
+func (r *gormLoginThrottleRepository) Save(ctx context.Context, throttle *LoginThrottle) error {
+	return conn(ctx, r.db).Save(throttle).Error
+}
+
+func (r *gormLoginThrottleRepository) Delete(ctx context.Context, key string) error {
+	return conn(ctx, r.db).Where("throttle_key = ?", key).Delete(&LoginThrottle{}).Error
+}
+
+type gormMFARepository struct {
+	db *gorm.DB
+}
+
+func (r *gormMFARepository) Find(ctx context.Context, userID uint) (*UserMFA, error) {
+	var mfa UserMFA
+	if err := conn(ctx, r.db).Where("user_id = ?", userID).First(&mfa).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &mfa, nil
+}
+
+func (r *gormMFARepository) FindEnabled(ctx context.Context, userID uint) (*UserMFA, error) {
+	var mfa UserMFA
+	if err := conn(ctx, r.db).Where("user_id = ? AND enabled_at IS NOT NULL", userID).First(&mfa).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &mfa, nil
+}
+
+func (r *gormMFARepository) Create(ctx context.Context, mfa *UserMFA) error {
+	return conn(ctx, r.db).Create(mfa).Error
+}
+
+func (r *gormMFARepository) Enable(ctx context.Context, id uint, at time.Time, step int64) error {
+	return conn(ctx, r.db).Model(&UserMFA{ID: id}).Updates(map[string]any{"enabled_at": at, "last_used_step": step}).Error
+}
+
+func (r *gormMFARepository) UseStep(ctx context.Context, id uint, step int64) (bool, error) {
+	result := conn(ctx, r.db).Model(&UserMFA{}).
+		Where("id = ? AND last_used_step < ?", id, step).
+		Update("last_used_step", step)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormMFARepository) Delete(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&UserMFA{}).Error
+	})
+}
+
+func (r *gormMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string, at time.Time) error {
+	return conn(ctx, r.db).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(codeHashes) == 0 {
+			return nil
+		}
+
+		records := make([]MFARecoveryCode, len(codeHashes))
+		for i, codeHash := range codeHashes {
+			records[i] = MFARecoveryCode{UserID: userID, CodeHash: codeHash, CreatedAt: at}
+		}
+		return tx.Create(&records).Error
+	})
+}
+
+func (r *gormMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error) {
+	result := conn(ctx, r.db).Model(&MFARecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormPasswordResetTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormPasswordResetTokenRepository) Create(ctx context.Context, token *PasswordResetToken) error {
+	return conn(ctx, r.db).Create(token).Error
+}
+
+func (r *gormPasswordResetTokenRepository) FindValid(ctx context.Context, tokenHash string, now time.Time) (*PasswordResetToken, error) {
+	var token PasswordResetToken
+	err := conn(db.Primary(ctx), r.db).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).First(&token).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (r *gormPasswordResetTokenRepository) Use(ctx context.Context, id uint, at time.Time) (bool, error) {
+	// The condition makes sure a token is used only once
+	result := conn(ctx, r.db).Model(&PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormPasswordResetTokenRepository) DeleteUnused(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Where("user_id = ? AND used_at IS NULL", userID).Delete(&PasswordResetToken{}).Error
+}
+
+type gormEmailVerificationTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormEmailVerificationTokenRepository) Create(ctx context.Context, token *EmailVerificationToken) error {
+	return conn(ctx, r.db).Create(token).Error
+}
+
+func (r *gormEmailVerificationTokenRepository) FindValid(ctx context.Context, tokenHash string, now time.Time) (*EmailVerificationToken, error) {
+	var token EmailVerificationToken
+	err := conn(db.Primary(ctx), r.db).Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", tokenHash, now).First(&token).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (r *gormEmailVerificationTokenRepository) Use(ctx context.Context, id uint, at time.Time) (bool, error) {
+	// The condition makes sure a token is used only once
+	result := conn(ctx, r.db).Model(&EmailVerificationToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", at)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormEmailVerificationTokenRepository) DeleteUnused(ctx context.Context, userID uint) error {
+	return conn(ctx, r.db).Where("user_id = ? AND used_at IS NULL", userID).Delete(&EmailVerificationToken{}).Error
+}
+
+func (r *gormEmailVerificationTokenRepository) CountCreatedAfter(ctx context.Context, userID uint, after time.Time) (int64, error) {
+	var count int64
+	err := conn(ctx, r.db).Model(&EmailVerificationToken{}).
+		Where("user_id = ? AND created_at > ?", userID, after).
+		Count(&count).Error
+	return count, err
+}
+
+type gormOAuthRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormOAuthRepository) CreateState(ctx context.Context, state *OAuthState) error {
+	return conn(ctx, r.db).Create(state).Error
+}
+
+func (r *gormOAuthRepository) FindState(ctx context.Context, stateHash string, provider string, now time.Time) (*OAuthState, error) {
+	var state OAuthState
+	err := conn(db.Primary(ctx), r.db).Where("state_hash = ? AND provider = ? AND expires_at > ?", stateHash, provider, now).First(&state).Error
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &state, nil
+}
+
+func (r *gormOAuthRepository) DeleteState(ctx context.Context, id uint) (bool, error) {
+	result := conn(ctx, r.db).Delete(&OAuthState{}, id)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *gormOAuthRepository) FindIdentity(ctx context.Context, provider string, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	if err := conn(ctx, r.db).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &identity, nil
+}
+
+func (r *gormOAuthRepository) ListIdentities(ctx context.Context, userID uint) ([]UserIdentity, error) {
+	identities := []UserIdentity{}
+	err := conn(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&identities).Error
+	return identities, err
+}
+
+func (r *gormOAuthRepository) CreateIdentity(ctx context.Context, identity *UserIdentity) error {
+	return conn(ctx, r.db).Create(identity).Error
+}
+
+func (r *gormOAuthRepository) TouchIdentity(ctx context.Context, id uint, email string, at time.Time) error {
+	return conn(ctx, r.db).Model(&UserIdentity{ID: id}).Updates(map[string]any{"email": email, "last_login_at": at}).Error
+}
+
+func (r *gormOAuthRepository) DeleteIdentity(ctx context.Context, userID uint, id uint) (bool, error) {
+	result := conn(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).Delete(&UserIdentity{})
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormAPIKeyRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormAPIKeyRepository) Create(ctx context.Context, key *APIKey) error {
+	return conn(ctx, r.db).Create(key).Error
+}
+
+func (r *gormAPIKeyRepository) FindByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	var key APIKey
+	if err := conn(db.Primary(ctx), r.db).Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &key, nil
+}
+
+func (r *gormAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]APIKey, error) {
+	var keys []APIKey
+	err := conn(ctx, r.db).Where("user_id = ?", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+func (r *gormAPIKeyRepository) Touch(ctx context.Context, id uint, at time.Time, ip string) error {
+	return conn(ctx, r.db).Model(&APIKey{ID: id}).Updates(map[string]any{
+		"last_used_at": at,
+		"last_used_ip": ip,
+	}).Error
+}
+
+func (r *gormAPIKeyRepository) Delete(ctx context.Context, userID uint, id uint) (bool, error) {
+	result := conn(ctx, r.db).Where("id = ? AND user_id = ?", id, userID).Delete(&APIKey{})
+	return result.RowsAffected > 0, result.Error
+}
+
+type gormSecurityEventRepository struct {
+	db *gorm.DB
+}
+
+func (r *gormSecurityEventRepository) Create(ctx context.Context, event *SecurityEvent) error {
+	return conn(ctx, r.db).Create(event).Error
+}
+
+// notFound translates the GORM not found error to ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
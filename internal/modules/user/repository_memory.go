@@ -0,0 +1,1012 @@
+package user
+
+import (
+	"gorm.io/gorm"
+
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDuplicateEmail = errors.New("duplicate email")
+
+// NewMemoryRepositories creates empty in-memory repositories of the user module, for tests and development
+// without a database. Roles have to be seeded, like on a new database.
+func NewMemoryRepositories() Repositories {
+	return Repositories{
+		Transactor:          &MemoryTransactor{},
+		Users:               NewMemoryUserRepository(),
+		Sessions:            NewMemorySessionRepository(),
+		Roles:               &MemoryRoleRepository{},
+		LoginThrottles:      &MemoryLoginThrottleRepository{},
+		MFA:                 &MemoryMFARepository{},
+		PasswordResetTokens: &MemoryPasswordResetTokenRepository{},
+		VerificationTokens:  &MemoryEmailVerificationTokenRepository{},
+		OAuth:               &MemoryOAuthRepository{},
+		APIKeys:             &MemoryAPIKeyRepository{},
+		SecurityEvents:      &MemorySecurityEventRepository{},
+	}
+}
+
+// MemoryTransactor runs one transaction at a time, nested transactions join the outer one. Changes
+// are not rolled back when a transaction fails, which tests of the happy path do not notice.
+type MemoryTransactor struct {
+	mu sync.Mutex
+}
+
+type memoryTxKey struct{}
+
+func (t *MemoryTransactor) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) == t {
+		return fn(ctx)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fn(context.WithValue(ctx, memoryTxKey{}, t))
+}
+
+// MemoryUserRepository keeps users in memory, for tests and development without a database
+type MemoryUserRepository struct {
+	mu      sync.RWMutex
+	nextID  uint
+	users   map[uint]User
+	details map[uint]UserDetail // By user ID
+}
+
+// NewMemoryUserRepository creates an empty in-memory user repository
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{
+		users:   map[uint]User{},
+		details: map[uint]UserDetail{},
+	}
+}
+
+// Add stores a user and its details, assigning the next ID if the user has none. IDs are never
+// reused, also not after an explicit ID.
+func (r *MemoryUserRepository) Add(user *User, detail UserDetail) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID == 0 {
+		r.nextID++
+		user.ID = r.nextID
+	}
+	r.nextID = max(r.nextID, user.ID)
+	detail.UserID = user.ID
+	r.users[user.ID] = *user
+	r.details[user.ID] = detail
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.users {
+		if existing.Email == user.Email {
+			return errDuplicateEmail // Unique index of the users table
+		}
+	}
+
+	r.nextID++
+	user.ID = r.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = time.Now()
+	}
+	if user.UpdatedAt.IsZero() {
+		user.UpdatedAt = user.CreatedAt
+	}
+	r.users[user.ID] = *user
+	return nil
+}
+
+func (r *MemoryUserRepository) CreateDetail(ctx context.Context, detail *UserDetail) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.details[detail.UserID] = *detail
+	return nil
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id uint) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || user.DeletedAt.Valid {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email && !user.DeletedAt.Valid {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) FindDetail(ctx context.Context, userID uint) (*UserDetail, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	detail, ok := r.details[userID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &detail, nil
+}
+
+// response joins a user with its details, like the admin query of the GORM repository
+func (r *MemoryUserRepository) response(user User) UserResponse {
+	detail := r.details[user.ID]
+	response := UserResponse{
+		ID:              user.ID,
+		Email:           user.Email,
+		FirstName:       detail.FirstName,
+		LastName:        detail.LastName,
+		Phone:           detail.Phone,
+		Bio:             detail.Bio,
+		AvatarURL:       detail.AvatarURL,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		UpdatedAt:       user.UpdatedAt,
+	}
+	if user.DeletedAt.Valid {
+		response.DeletedAt = &user.DeletedAt.Time
+	}
+	return response
+}
+
+func (r *MemoryUserRepository) FindResponse(ctx context.Context, id uint, includeDeleted bool) (*UserResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[id]
+	if !ok || (user.DeletedAt.Valid && !includeDeleted) {
+		return nil, ErrNotFound
+	}
+	response := r.response(user)
+	return &response, nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, query ListUsersQuery) ([]UserResponse, int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	email, name := strings.ToLower(query.Email), strings.ToLower(query.Name)
+	createdFrom, _ := time.ParseInLocation("2006-01-02", query.CreatedFrom, time.Local) // Already validated
+	createdTo, _ := time.ParseInLocation("2006-01-02", query.CreatedTo, time.Local)
+
+	users := []UserResponse{}
+	for _, user := range r.users {
+		response := r.response(user)
+		switch {
+		case user.DeletedAt.Valid && !query.IncludeDeleted,
+			!strings.Contains(strings.ToLower(response.Email), email),
+			name != "" && !strings.Contains(strings.ToLower(response.FirstName), name) && !strings.Contains(strings.ToLower(response.LastName), name),
+			query.CreatedFrom != "" && response.CreatedAt.Before(createdFrom),
+			query.CreatedTo != "" && !response.CreatedAt.Before(createdTo.AddDate(0, 0, 1)):
+			continue
+		}
+		users = append(users, response)
+	}
+
+	// Sorting, "-" prefix means descending, ties are broken by ID
+	key, descending := strings.TrimPrefix(query.Sort, "-"), strings.HasPrefix(query.Sort, "-")
+	sort.Slice(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if descending {
+			a, b = b, a
+		}
+		var c int
+		switch key {
+		case "email":
+			c = strings.Compare(a.Email, b.Email)
+		case "created_at":
+			c = a.CreatedAt.Compare(b.CreatedAt)
+		case "first_name":
+			c = strings.Compare(a.FirstName, b.FirstName)
+		case "last_name":
+			c = strings.Compare(a.LastName, b.LastName)
+		}
+		if c != 0 {
+			return c < 0
+		}
+		return a.ID < b.ID
+	})
+
+	total := int64(len(users))
+	offset := min((query.Page-1)*query.PerPage, len(users))
+	return users[offset:min(offset+query.PerPage, len(users))], total, nil
+}
+
+func (r *MemoryUserRepository) EmailExists(ctx context.Context, email string, includeDeleted bool) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email == email && (includeDeleted || !user.DeletedAt.Valid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryUserRepository) UpdateDetail(ctx context.Context, userID uint, update UserDetailUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	detail, ok := r.details[userID]
+	if !ok {
+		return nil // Updates no row, like the GORM repository
+	}
+	if update.FirstName != nil {
+		detail.FirstName = *update.FirstName
+	}
+	if update.LastName != nil {
+		detail.LastName = *update.LastName
+	}
+	if update.Phone != nil {
+		detail.Phone = *update.Phone
+	}
+	if update.Bio != nil {
+		detail.Bio = *update.Bio
+	}
+	if update.AvatarURL != nil {
+		detail.AvatarURL = *update.AvatarURL
+	}
+	r.details[userID] = detail
+	return nil
+}
+
+func (r *MemoryUserRepository) UpdateEmail(ctx context.Context, userID uint, email string) error {
+	return r.update(userID, func(user *User) {
+		user.Email = email
+		user.EmailVerifiedAt = nil
+	})
+}
+
+func (r *MemoryUserRepository) UpdatePassword(ctx context.Context, userID uint, passwordHash string) error {
+	return r.update(userID, func(user *User) {
+		user.Password = passwordHash
+	})
+}
+
+func (r *MemoryUserRepository) MarkEmailVerified(ctx context.Context, userID uint, at time.Time) error {
+	err := r.update(userID, func(user *User) {
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &at
+		}
+	})
+	if err == ErrNotFound {
+		return nil // Updates no row, like the GORM repository
+	}
+	return err
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, userID uint) error {
+	return r.update(userID, func(user *User) {
+		user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	})
+}
+
+// update changes a user that is not soft deleted, ErrNotFound if there is none
+func (r *MemoryUserRepository) update(userID uint, change func(user *User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	change(&user)
+	user.UpdatedAt = time.Now()
+	r.users[userID] = user
+	return nil
+}
+
+// MemorySessionRepository keeps sessions in memory, for tests and development without a database
+type MemorySessionRepository struct {
+	mu       sync.RWMutex
+	nextID   uint
+	sessions map[uint]UserSession
+}
+
+// NewMemorySessionRepository creates an empty in-memory session repository
+func NewMemorySessionRepository() *MemorySessionRepository {
+	return &MemorySessionRepository{sessions: map[uint]UserSession{}}
+}
+
+func (r *MemorySessionRepository) Create(ctx context.Context, session *UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	session.ID = r.nextID
+	r.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *MemorySessionRepository) FindByID(ctx context.Context, userID uint, id uint) (*UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.UserID != userID {
+		return nil, ErrNotFound
+	}
+	return &session, nil
+}
+
+func (r *MemorySessionRepository) FindByJTI(ctx context.Context, jti string) (*UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, session := range r.sessions {
+		if session.JTI == jti {
+			return &session, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemorySessionRepository) ListActive(ctx context.Context, userID uint, now time.Time) ([]UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []UserSession
+	for _, session := range r.sessions {
+		if session.UserID == userID && session.RotatedAt == nil && session.ExpiresAt.After(now) {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+func (r *MemorySessionRepository) Rotate(ctx context.Context, id uint, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[id]
+	if !ok || session.RotatedAt != nil {
+		return false, nil
+	}
+	session.RotatedAt = &at
+	r.sessions[id] = session
+	return true, nil
+}
+
+func (r *MemorySessionRepository) Touch(ctx context.Context, id uint, at time.Time, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.LastSeenAt = at
+		session.IPAddress = ip
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteFamily(ctx context.Context, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.FamilyID == familyID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteOtherFamilies(ctx context.Context, userID uint, keepFamilyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID && session.FamilyID != keepFamilyID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *MemorySessionRepository) DeleteByUser(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.UserID == userID {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+// MemoryRoleRepository keeps roles in memory, for tests and development without a database
+type MemoryRoleRepository struct {
+	mu        sync.RWMutex
+	roles     []Role            // With their permissions
+	userRoles map[uint][]string // Role names by user ID
+}
+
+func (r *MemoryRoleRepository) Seed(ctx context.Context, rolePermissions map[string][]string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for roleName, permissionNames := range rolePermissions {
+		role := r.findOrCreate(roleName)
+		for _, permissionName := range permissionNames {
+			if !slices.ContainsFunc(role.Permissions, func(p Permission) bool { return p.Name == permissionName }) {
+				role.Permissions = append(role.Permissions, Permission{Name: permissionName})
+			}
+		}
+	}
+	return nil
+}
+
+// findOrCreate returns the role of the name, the caller holds the write lock
+func (r *MemoryRoleRepository) findOrCreate(name string) *Role {
+	for i := range r.roles {
+		if r.roles[i].Name == name {
+			return &r.roles[i]
+		}
+	}
+	r.roles = append(r.roles, Role{ID: uint(len(r.roles) + 1), Name: name}) // Roles are never deleted
+	return &r.roles[len(r.roles)-1]
+}
+
+func (r *MemoryRoleRepository) FindByNames(ctx context.Context, names []string) ([]Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var roles []Role
+	for _, role := range r.roles {
+		if slices.Contains(names, role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *MemoryRoleRepository) FindByUser(ctx context.Context, userID uint) ([]Role, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var roles []Role
+	for _, role := range r.roles {
+		if slices.Contains(r.userRoles[userID], role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (r *MemoryRoleRepository) NamesByUser(ctx context.Context, userIDs []uint) (map[uint][]string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rolesByUser := map[uint][]string{}
+	for _, userID := range userIDs {
+		if names := r.userRoles[userID]; len(names) > 0 {
+			rolesByUser[userID] = slices.Clone(names)
+		}
+	}
+	return rolesByUser, nil
+}
+
+func (r *MemoryRoleRepository) Assign(ctx context.Context, userID uint, roleName string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.findOrCreate(roleName)
+	if r.userRoles == nil {
+		r.userRoles = map[uint][]string{}
+	}
+	if !slices.Contains(r.userRoles[userID], roleName) {
+		r.userRoles[userID] = append(r.userRoles[userID], roleName)
+	}
+	return nil
+}
+
+func (r *MemoryRoleRepository) Replace(ctx context.Context, userID uint, roles []Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	if r.userRoles == nil {
+		r.userRoles = map[uint][]string{}
+	}
+	r.userRoles[userID] = names
+	return nil
+}
+
+// MemoryLoginThrottleRepository keeps failed login counters in memory, for tests and development without a database
+type MemoryLoginThrottleRepository struct {
+	mu        sync.RWMutex
+	throttles []LoginThrottle
+}
+
+func (r *MemoryLoginThrottleRepository) FindLocked(ctx context.Context, keys []string, now time.Time) ([]LoginThrottle, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var throttles []LoginThrottle
+	for _, throttle := range r.throttles {
+		if slices.Contains(keys, throttle.ThrottleKey) && throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+			throttles = append(throttles, throttle)
+		}
+	}
+	return throttles, nil
+}
+
+// FindForUpdate does not lock, transactions of the MemoryTransactor run one at a time anyway
+func (r *MemoryLoginThrottleRepository) FindForUpdate(ctx context.Context, key string) (*LoginThrottle, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, throttle := range r.throttles {
+		if throttle.ThrottleKey == key {
+			return &throttle, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryLoginThrottleRepository) Save(ctx context.Context, throttle *LoginThrottle) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.throttles {
+		if r.throttles[i].ThrottleKey == throttle.ThrottleKey {
+			throttle.ID = r.throttles[i].ID
+			r.throttles[i] = *throttle
+			return nil
+		}
+	}
+	throttle.ID = uint(len(r.throttles) + 1)
+	r.throttles = append(r.throttles, *throttle)
+	return nil
+}
+
+func (r *MemoryLoginThrottleRepository) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.throttles = slices.DeleteFunc(r.throttles, func(throttle LoginThrottle) bool {
+		return throttle.ThrottleKey == key
+	})
+	return nil
+}
+
+// MemoryMFARepository keeps second factors in memory, for tests and development without a database
+type MemoryMFARepository struct {
+	mu            sync.RWMutex
+	nextID        uint
+	mfas          []UserMFA
+	recoveryCodes []MFARecoveryCode
+}
+
+func (r *MemoryMFARepository) Find(ctx context.Context, userID uint) (*UserMFA, error) {
+	return r.find(func(mfa UserMFA) bool { return mfa.UserID == userID })
+}
+
+func (r *MemoryMFARepository) FindEnabled(ctx context.Context, userID uint) (*UserMFA, error) {
+	return r.find(func(mfa UserMFA) bool { return mfa.UserID == userID && mfa.EnabledAt != nil })
+}
+
+func (r *MemoryMFARepository) find(match func(mfa UserMFA) bool) (*UserMFA, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if i := slices.IndexFunc(r.mfas, match); i >= 0 {
+		mfa := r.mfas[i]
+		return &mfa, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryMFARepository) Create(ctx context.Context, mfa *UserMFA) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	mfa.ID = r.nextID
+	r.mfas = append(r.mfas, *mfa)
+	return nil
+}
+
+func (r *MemoryMFARepository) Enable(ctx context.Context, id uint, at time.Time, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.mfas {
+		if r.mfas[i].ID == id {
+			r.mfas[i].EnabledAt = &at
+			r.mfas[i].LastUsedStep = step
+		}
+	}
+	return nil
+}
+
+func (r *MemoryMFARepository) UseStep(ctx context.Context, id uint, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.mfas {
+		if r.mfas[i].ID == id && r.mfas[i].LastUsedStep < step {
+			r.mfas[i].LastUsedStep = step
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *MemoryMFARepository) Delete(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.mfas = slices.DeleteFunc(r.mfas, func(mfa UserMFA) bool { return mfa.UserID == userID })
+	r.recoveryCodes = slices.DeleteFunc(r.recoveryCodes, func(code MFARecoveryCode) bool { return code.UserID == userID })
+	return nil
+}
+
+func (r *MemoryMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID uint, codeHashes []string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recoveryCodes = slices.DeleteFunc(r.recoveryCodes, func(code MFARecoveryCode) bool { return code.UserID == userID })
+	for _, codeHash := range codeHashes {
+		r.recoveryCodes = append(r.recoveryCodes, MFARecoveryCode{UserID: userID, CodeHash: codeHash, CreatedAt: at})
+	}
+	return nil
+}
+
+func (r *MemoryMFARepository) UseRecoveryCode(ctx context.Context, userID uint, codeHash string, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.recoveryCodes {
+		code := &r.recoveryCodes[i]
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			code.UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// MemoryPasswordResetTokenRepository keeps password reset tokens in memory, for tests and development without a database
+type MemoryPasswordResetTokenRepository struct {
+	mu     sync.RWMutex
+	tokens []PasswordResetToken
+}
+
+func (r *MemoryPasswordResetTokenRepository) Create(ctx context.Context, token *PasswordResetToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uint(len(r.tokens) + 1) // Tokens are never removed, only marked as used or left unused
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *MemoryPasswordResetTokenRepository) FindValid(ctx context.Context, tokenHash string, now time.Time) (*PasswordResetToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryPasswordResetTokenRepository) Use(ctx context.Context, id uint, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+			r.tokens[i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteUnused invalidates the unused tokens of the user, they are kept so IDs are never reused
+func (r *MemoryPasswordResetTokenRepository) DeleteUnused(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].UserID == userID && r.tokens[i].UsedAt == nil {
+			r.tokens[i].TokenHash = ""
+		}
+	}
+	return nil
+}
+
+// MemoryEmailVerificationTokenRepository keeps email verification tokens in memory, for tests and development without a database
+type MemoryEmailVerificationTokenRepository struct {
+	mu     sync.RWMutex
+	tokens []EmailVerificationToken
+}
+
+func (r *MemoryEmailVerificationTokenRepository) Create(ctx context.Context, token *EmailVerificationToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token.ID = uint(len(r.tokens) + 1) // Tokens are never removed, only marked as used or left unused
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *MemoryEmailVerificationTokenRepository) FindValid(ctx context.Context, tokenHash string, now time.Time) (*EmailVerificationToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, token := range r.tokens {
+		if token.TokenHash == tokenHash && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryEmailVerificationTokenRepository) Use(ctx context.Context, id uint, at time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].ID == id && r.tokens[i].UsedAt == nil {
+			r.tokens[i].UsedAt = &at
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteUnused invalidates the unused tokens of the user, they are kept so IDs are never reused
+func (r *MemoryEmailVerificationTokenRepository) DeleteUnused(ctx context.Context, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.tokens {
+		if r.tokens[i].UserID == userID && r.tokens[i].UsedAt == nil {
+			r.tokens[i].TokenHash = ""
+		}
+	}
+	return nil
+}
+
+func (r *MemoryEmailVerificationTokenRepository) CountCreatedAfter(ctx context.Context, userID uint, after time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, token := range r.tokens {
+		if token.UserID == userID && token.CreatedAt.After(after) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// MemoryOAuthRepository keeps authorization requests and identities in memory, for tests and development without a database
+type MemoryOAuthRepository struct {
+	mu             sync.RWMutex
+	nextStateID    uint
+	nextIdentityID uint
+	states         []OAuthState
+	identities     []UserIdentity
+}
+
+func (r *MemoryOAuthRepository) CreateState(ctx context.Context, state *OAuthState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextStateID++
+	state.ID = r.nextStateID
+	r.states = append(r.states, *state)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) FindState(ctx context.Context, stateHash string, provider string, now time.Time) (*OAuthState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, state := range r.states {
+		if state.StateHash == stateHash && state.Provider == provider && state.ExpiresAt.After(now) {
+			return &state, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryOAuthRepository) DeleteState(ctx context.Context, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.states)
+	r.states = slices.DeleteFunc(r.states, func(state OAuthState) bool { return state.ID == id })
+	return len(r.states) < n, nil
+}
+
+func (r *MemoryOAuthRepository) FindIdentity(ctx context.Context, provider string, subject string) (*UserIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryOAuthRepository) ListIdentities(ctx context.Context, userID uint) ([]UserIdentity, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	identities := []UserIdentity{}
+	for _, identity := range r.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (r *MemoryOAuthRepository) CreateIdentity(ctx context.Context, identity *UserIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextIdentityID++
+	identity.ID = r.nextIdentityID
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *MemoryOAuthRepository) TouchIdentity(ctx context.Context, id uint, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.identities {
+		if r.identities[i].ID == id {
+			r.identities[i].Email = email
+			r.identities[i].LastLoginAt = &at
+		}
+	}
+	return nil
+}
+
+func (r *MemoryOAuthRepository) DeleteIdentity(ctx context.Context, userID uint, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.identities)
+	r.identities = slices.DeleteFunc(r.identities, func(identity UserIdentity) bool {
+		return identity.ID == id && identity.UserID == userID
+	})
+	return len(r.identities) < n, nil
+}
+
+// MemoryAPIKeyRepository keeps API keys in memory, for tests and development without a database
+type MemoryAPIKeyRepository struct {
+	mu     sync.RWMutex
+	nextID uint
+	keys   []APIKey
+}
+
+func (r *MemoryAPIKeyRepository) Create(ctx context.Context, key *APIKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	key.ID = r.nextID
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now()
+	}
+	r.keys = append(r.keys, *key)
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) FindByHash(ctx context.Context, keyHash string) (*APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, key := range r.keys {
+		if key.KeyHash == keyHash {
+			return &key, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryAPIKeyRepository) ListByUser(ctx context.Context, userID uint) ([]APIKey, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var keys []APIKey
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *MemoryAPIKeyRepository) Touch(ctx context.Context, id uint, at time.Time, ip string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.keys {
+		if r.keys[i].ID == id {
+			r.keys[i].LastUsedAt = &at
+			r.keys[i].LastUsedIP = ip
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAPIKeyRepository) Delete(ctx context.Context, userID uint, id uint) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.keys)
+	r.keys = slices.DeleteFunc(r.keys, func(key APIKey) bool { return key.ID == id && key.UserID == userID })
+	return len(r.keys) < n, nil
+}
+
+// MemorySecurityEventRepository keeps security events in memory, for tests and development without a database
+type MemorySecurityEventRepository struct {
+	mu     sync.RWMutex
+	events []SecurityEvent
+}
+
+func (r *MemorySecurityEventRepository) Create(ctx context.Context, event *SecurityEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.ID = uint(len(r.events) + 1)
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	r.events = append(r.events, *event)
+	return nil
+}
+
+// Events returns the stored events, oldest first
+func (r *MemorySecurityEventRepository) Events() []SecurityEvent {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.events)
+}
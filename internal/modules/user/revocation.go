@@ -0,0 +1,36 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+
+	"context"
+	"strings"
+)
+
+// revokeUserTokens revokes every access and refresh token issued to the user until now.
+// The change that caused it is already saved, so a failure is only logged.
+func (s *Service) revokeUserTokens(ctx context.Context, userID uint) {
+	if err := revocation.RevokeUser(ctx, s.Revocations, userID, s.Clock()); err != nil {
+		s.Logger.ErrorContext(ctx, "Failed to revoke tokens", "target_user_id", userID, "error", err)
+	}
+}
+
+// revokeRequestTokens revokes the access token of the Authorization header and the refresh token of the request, if they are valid
+func (s *Service) revokeRequestTokens(c *fiber.Ctx) {
+	if accessTokenString, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer "); ok {
+		if claims, err := s.Tokens.ParseAccessToken(accessTokenString); err == nil {
+			if err := revocation.RevokeClaims(c.UserContext(), s.Revocations, claims); err != nil {
+				s.Logger.ErrorContext(c.UserContext(), "Failed to revoke access token", "target_user_id", claims.UserID, "error", err)
+			}
+		}
+	}
+
+	if refreshTokenString := s.RefreshTokenFromRequest(c); refreshTokenString != "" {
+		if claims, err := s.Tokens.ParseRefreshToken(refreshTokenString); err == nil {
+			if err := revocation.RevokeClaims(c.UserContext(), s.Revocations, claims); err != nil {
+				s.Logger.ErrorContext(c.UserContext(), "Failed to revoke refresh token", "target_user_id", claims.UserID, "error", err)
+			}
+		}
+	}
+}
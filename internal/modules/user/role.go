@@ -0,0 +1,73 @@
+package user
+
+import (
+	"context"
+)
+
+// Built-in roles
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Built-in permissions
+const (
+	PermissionUsersRead   = "users:read"
+	PermissionUsersWrite  = "users:write"
+	PermissionUsersDelete = "users:delete"
+)
+
+// DefaultRolePermissions maps every built-in role to the permissions it grants.
+var DefaultRolePermissions = map[string][]string{
+	RoleAdmin: {PermissionUsersRead, PermissionUsersWrite, PermissionUsersDelete},
+	RoleUser:  {},
+}
+
+// SeedRoles makes sure the built-in roles and permissions exist. If ADMIN_EMAIL is set
+// and a user with that email exists, the admin role is granted to that user.
+func (s *Service) SeedRoles() error {
+	ctx := context.Background()
+	if err := s.Roles.Seed(ctx, DefaultRolePermissions); err != nil {
+		return err
+	}
+
+	// Seed the first admin, if configured
+	adminEmail := s.Config.App.AdminEmail
+	if adminEmail == "" {
+		return nil
+	}
+
+	admin, err := s.Users.FindByEmail(ctx, adminEmail)
+	if err != nil {
+		if err == ErrNotFound {
+			s.Logger.Warn("Admin user not found, skipping admin role seeding", "email", adminEmail)
+			return nil
+		}
+		return err
+	}
+
+	return s.Roles.Assign(ctx, admin.ID, RoleAdmin)
+}
+
+// GetUserRolesAndPermissions returns the role names and the de-duplicated permission names of a user.
+func (s *Service) GetUserRolesAndPermissions(ctx context.Context, userID uint) ([]string, []string, error) {
+	roles, err := s.Roles.FindByUser(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleNames := []string{}
+	permissionNames := []string{}
+	seen := map[string]bool{}
+	for _, role := range roles {
+		roleNames = append(roleNames, role.Name)
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				permissionNames = append(permissionNames, permission.Name)
+			}
+		}
+	}
+
+	return roleNames, permissionNames, nil
+}
@@ -0,0 +1,29 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Security event types
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventAPIKeyCreated     = "api_key_created"
+	SecurityEventAPIKeyRevoked     = "api_key_revoked"
+)
+
+// recordSecurityEvent stores a security event for the user, with the client IP and user agent of the request
+func (s *Service) recordSecurityEvent(c *fiber.Ctx, userID uint, eventType string, familyID string) {
+	event := SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		FamilyID:  familyID,
+		IPAddress: c.IP(),
+		UserAgent: c.Get(fiber.HeaderUserAgent),
+		CreatedAt: s.Clock(),
+	}
+	if err := s.SecurityEvents.Create(c.UserContext(), &event); err != nil {
+		s.Logger.ErrorContext(c.UserContext(), "Failed to record security event", "event", eventType, "target_user_id", userID, "error", err)
+		return
+	}
+	s.Logger.WarnContext(c.UserContext(), "Security event", "event", eventType, "target_user_id", userID, "family_id", familyID, "ip", event.IPAddress)
+}
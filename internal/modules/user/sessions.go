@@ -0,0 +1,106 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+)
+
+// currentSessionFamilyID returns the rotation family of the refresh token of the request, or an empty string
+func (s *Service) currentSessionFamilyID(c *fiber.Ctx, userID uint) string {
+	jti := s.refreshTokenJTIFromRequest(c)
+	if jti == "" {
+		return ""
+	}
+
+	session, err := s.Sessions.FindByJTI(c.UserContext(), jti)
+	if err != nil || session.UserID != userID {
+		return ""
+	}
+	return session.FamilyID
+}
+
+func (s *Service) ListSessionsHandler(c *fiber.Ctx) error {
+	if !s.Config.Session.Stateful() {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "sessions_not_supported")
+	}
+
+	userID := currentUserID(c)
+	currentFamilyID := s.currentSessionFamilyID(c, userID)
+
+	// Only the latest session of every rotation family is active
+	userSessions, err := s.Sessions.ListActive(c.UserContext(), userID, s.Clock())
+	if err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user sessions")
+	}
+
+	sessions := make([]SessionResponse, len(userSessions))
+	for i, session := range userSessions {
+		sessions[i] = SessionResponse{
+			ID:         session.ID,
+			Label:      session.Label,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			Current:    session.FamilyID == currentFamilyID,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+			LastSeenAt: session.LastSeenAt,
+		}
+	}
+
+	return response.SendSuccessResponse(c, "User sessions fetched successfully", sessions)
+}
+
+func (s *Service) RevokeSessionHandler(c *fiber.Ctx) error {
+	if !s.Config.Session.Stateful() {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "sessions_not_supported")
+	}
+
+	sessionID, err := c.ParamsInt("id")
+	if err != nil || sessionID <= 0 {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "session_not_found")
+	}
+
+	userID := currentUserID(c)
+
+	session, err := s.Sessions.FindByID(c.UserContext(), userID, uint(sessionID))
+	if err != nil {
+		if err == ErrNotFound {
+			return response.SendErrorResponse(c, fiber.StatusNotFound, "session_not_found")
+		}
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query user session")
+	}
+
+	// Look up the current session before its family is deleted
+	currentFamilyID := s.currentSessionFamilyID(c, userID)
+
+	// Revoke the whole rotation family of the session
+	if err := s.Sessions.DeleteFamily(c.UserContext(), session.FamilyID); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to revoke user session")
+	}
+
+	// Revoking the current session is the same as logging out
+	if session.FamilyID == currentFamilyID {
+		s.clearRefreshTokenCookie(c)
+	}
+
+	return response.SendSuccessResponse(c, "User session revoked successfully", nil)
+}
+
+// RevokeOtherSessionsHandler logs the user out everywhere else, keeping only the current session
+func (s *Service) RevokeOtherSessionsHandler(c *fiber.Ctx) error {
+	if !s.Config.Session.Stateful() {
+		return response.SendErrorResponse(c, fiber.StatusBadRequest, "sessions_not_supported")
+	}
+
+	userID := currentUserID(c)
+	currentFamilyID := s.currentSessionFamilyID(c, userID)
+	if currentFamilyID == "" {
+		return response.SendErrorResponse(c, fiber.StatusUnauthorized, "session_expired")
+	}
+
+	if err := s.Sessions.DeleteOtherFamilies(c.UserContext(), userID, currentFamilyID); err != nil {
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to revoke user sessions")
+	}
+
+	return response.SendSuccessResponse(c, "Other user sessions revoked successfully", nil)
+}
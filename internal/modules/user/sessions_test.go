@@ -0,0 +1,162 @@
+package user
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newSessionsTestApp serves the session endpoints on top of newTestApp
+func newSessionsTestApp(s *Service) *fiber.App {
+	app := newTestApp(s)
+	app.Get("/me/sessions", authenticate(s), s.ListSessionsHandler)
+	app.Delete("/me/sessions", authenticate(s), s.RevokeOtherSessionsHandler)
+	app.Delete("/me/sessions/:id", authenticate(s), s.RevokeSessionHandler)
+	return app
+}
+
+// device is a signed in client, sending its refresh token along like a mobile app
+type device struct {
+	accessToken  string
+	refreshToken string
+}
+
+func loginDevice(t *testing.T, app *fiber.App, email, label string) device {
+	t.Helper()
+
+	res := do(t, app, http.MethodPost, "/login", LoginRequest{Email: email, Password: testPassword, DeviceLabel: label}, nil)
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("login %s = %d (%s), want 200", label, res.Status, res.Code)
+	}
+	accessToken, _ := res.Data["access_token"].(string)
+	refreshToken, _ := res.Data["refresh_token"].(string)
+	return device{accessToken: accessToken, refreshToken: refreshToken}
+}
+
+func (d device) headers() map[string]string {
+	headers := bearer(d.accessToken)
+	headers["X-Refresh-Token"] = d.refreshToken
+	return headers
+}
+
+// listSessions returns the sessions of the device user by label
+func listSessions(t *testing.T, app *fiber.App, d device) map[string]SessionResponse {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, "/me/sessions", nil)
+	req.Header.Set("X-Client-Type", ClientTypeMobile)
+	for name, value := range d.headers() {
+		req.Header.Set(name, value)
+	}
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("list sessions = %d, want 200", res.StatusCode)
+	}
+
+	var body struct {
+		Data []SessionResponse `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	sessions := map[string]SessionResponse{}
+	for _, session := range body.Data {
+		sessions[session.Label] = session
+	}
+	return sessions
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	s := newTestService(t)
+	app := newSessionsTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+	addTestUser(t, s, "john@example.com", true)
+
+	phone := loginDevice(t, app, "jane@example.com", "Phone")
+	laptop := loginDevice(t, app, "jane@example.com", "Laptop")
+	johnsPhone := loginDevice(t, app, "john@example.com", "Phone")
+
+	// A refresh rotates the session, the family stays one session
+	res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": phone.refreshToken})
+	if res.Status != fiber.StatusOK {
+		t.Fatalf("refresh = %d (%s), want 200", res.Status, res.Code)
+	}
+	phone.refreshToken, _ = res.Data["refresh_token"].(string)
+
+	sessions := listSessions(t, app, phone)
+	if len(sessions) != 2 || !sessions["Phone"].Current || sessions["Laptop"].Current {
+		t.Fatalf("sessions = %+v, want the current Phone and Laptop", sessions)
+	}
+
+	// Sessions of other users are not found
+	johnsSessions := listSessions(t, app, johnsPhone)
+	path := fmt.Sprintf("/me/sessions/%d", johnsSessions["Phone"].ID)
+	if res := do(t, app, http.MethodDelete, path, nil, phone.headers()); res.Status != fiber.StatusNotFound || res.Code != "session_not_found" {
+		t.Errorf("revoke a session of another user = %d (%s), want 404 session_not_found", res.Status, res.Code)
+	}
+
+	path = fmt.Sprintf("/me/sessions/%d", sessions["Laptop"].ID)
+	if res := do(t, app, http.MethodDelete, path, nil, phone.headers()); res.Status != fiber.StatusOK {
+		t.Fatalf("revoke the laptop session = %d (%s), want 200", res.Status, res.Code)
+	}
+	if res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": laptop.refreshToken}); res.Status != fiber.StatusUnauthorized {
+		t.Errorf("refresh on the revoked laptop = %d (%s), want 401", res.Status, res.Code)
+	}
+	if sessions := listSessions(t, app, phone); len(sessions) != 1 {
+		t.Errorf("sessions after revoking the laptop = %+v, want only the phone", sessions)
+	}
+}
+
+func TestRevokeOtherSessions(t *testing.T) {
+	s := newTestService(t)
+	app := newSessionsTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	phone := loginDevice(t, app, "jane@example.com", "Phone")
+	laptop := loginDevice(t, app, "jane@example.com", "Laptop")
+	tablet := loginDevice(t, app, "jane@example.com", "Tablet")
+
+	// Without its refresh token the current session is unknown
+	if res := do(t, app, http.MethodDelete, "/me/sessions", nil, bearer(phone.accessToken)); res.Status != fiber.StatusUnauthorized || res.Code != "session_expired" {
+		t.Errorf("revoke other sessions without a refresh token = %d (%s), want 401 session_expired", res.Status, res.Code)
+	}
+
+	if res := do(t, app, http.MethodDelete, "/me/sessions", nil, phone.headers()); res.Status != fiber.StatusOK {
+		t.Fatalf("revoke other sessions = %d (%s), want 200", res.Status, res.Code)
+	}
+	for _, d := range []device{laptop, tablet} {
+		if res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": d.refreshToken}); res.Status != fiber.StatusUnauthorized {
+			t.Errorf("refresh on a revoked device = %d (%s), want 401", res.Status, res.Code)
+		}
+	}
+	if res := do(t, app, http.MethodPost, "/refresh", nil, map[string]string{"X-Refresh-Token": phone.refreshToken}); res.Status != fiber.StatusOK {
+		t.Errorf("refresh on the current device = %d (%s), want 200", res.Status, res.Code)
+	}
+}
+
+func TestSessionsNeedStatefulMode(t *testing.T) {
+	s := newTestService(t)
+	s.Config.Session.Mode = config.SessionModeStateless
+	app := newSessionsTestApp(s)
+	addTestUser(t, s, "jane@example.com", true)
+
+	phone := loginDevice(t, app, "jane@example.com", "Phone")
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodGet, "/me/sessions"},
+		{http.MethodDelete, "/me/sessions"},
+		{http.MethodDelete, "/me/sessions/1"},
+	} {
+		if res := do(t, app, tt.method, tt.path, nil, phone.headers()); res.Status != fiber.StatusBadRequest || res.Code != "sessions_not_supported" {
+			t.Errorf("%s %s in stateless mode = %d (%s), want 400 sessions_not_supported", tt.method, tt.path, res.Status, res.Code)
+		}
+	}
+}
@@ -1,41 +0,0 @@
-package user
-
-import (
-	"github.com/gofiber/fiber/v2"
-	"github.com/sonyarianto/gobete/internal/systems/response"
-)
-
-func UpdateCurrentUserHandler(c *fiber.Ctx) error {
-	// TODO: Implement update current user profile logic
-	return response.SendSuccessResponse(c, "Update current user - not implemented yet", nil)
-}
-
-func ChangePasswordHandler(c *fiber.Ctx) error {
-	// TODO: Implement change password logic
-	return response.SendSuccessResponse(c, "Change password - not implemented yet", nil)
-}
-
-func DeleteCurrentUserHandler(c *fiber.Ctx) error {
-	// TODO: Implement delete current user logic
-	return response.SendSuccessResponse(c, "Delete current user - not implemented yet", nil)
-}
-
-func ListUsersHandler(c *fiber.Ctx) error {
-	// TODO: Implement list users logic (admin only)
-	return response.SendSuccessResponse(c, "List users - not implemented yet", nil)
-}
-
-func GetUserByIDHandler(c *fiber.Ctx) error {
-	// TODO: Implement get user by ID logic (admin only)
-	return response.SendSuccessResponse(c, "Get user by ID - not implemented yet", nil)
-}
-
-func DeleteUserByIDHandler(c *fiber.Ctx) error {
-	// TODO: Implement delete user by ID logic (admin only)
-	return response.SendSuccessResponse(c, "Delete user by ID - not implemented yet", nil)
-}
-
-func UpdateUserByIDHandler(c *fiber.Ctx) error {
-	// TODO: Implement update user by ID logic (admin only)
-	return response.SendSuccessResponse(c, "Update user by ID - not implemented yet", nil)
-}
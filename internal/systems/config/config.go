@@ -0,0 +1,274 @@
+// Package config loads the application configuration once at startup, from defaults, an optional
+// YAML or TOML file (CONFIG_FILE), the .env file and the environment, in increasing priority.
+// The result is validated, so the application refuses to start with a broken configuration.
+package config
+
+import (
+	"github.com/joho/godotenv"
+
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+)
+
+// Session modes
+const (
+	SessionModeStateless = "jwt_stateless"
+	SessionModeStateful  = "jwt_server_stateful"
+)
+
+// Config is the application configuration. Every field is set with the env variable of its env tag,
+// or with the key of its yaml/toml tag in the config file.
+type Config struct {
+	App               AppConfig               `yaml:"app" toml:"app"`
+	Log               LogConfig               `yaml:"log" toml:"log"`
+	CORS              CORSConfig              `yaml:"cors" toml:"cors"`
+	DB                DBConfig                `yaml:"db" toml:"db"`
+	JWT               JWTConfig               `yaml:"jwt" toml:"jwt"`
+	Session           SessionConfig           `yaml:"session" toml:"session"`
+	Revocation        RevocationConfig        `yaml:"revocation" toml:"revocation"`
+	Login             LoginConfig             `yaml:"login" toml:"login"`
+	MFA               MFAConfig               `yaml:"mfa" toml:"mfa"`
+	APIKey            APIKeyConfig            `yaml:"api_key" toml:"api_key"`
+	EmailVerification EmailVerificationConfig `yaml:"email_verification" toml:"email_verification"`
+	PasswordReset     PasswordResetConfig     `yaml:"password_reset" toml:"password_reset"`
+	Mail              MailConfig              `yaml:"mail" toml:"mail"`
+	OIDC              OIDCConfig              `yaml:"oidc" toml:"oidc"`
+}
+
+type AppConfig struct {
+	Env        string `env:"ENV" yaml:"env" toml:"env" validate:"oneof=development staging production test"`
+	Port       int    `env:"APP_PORT" yaml:"port" toml:"port" validate:"min=1,max=65535"`
+	Version    string `env:"APP_VERSION" yaml:"version" toml:"version"`
+	AdminEmail string `env:"ADMIN_EMAIL" yaml:"admin_email" toml:"admin_email" validate:"omitempty,email"` // Gets the admin role on startup
+	// Deadline of a request, database queries and outbound calls still running then are canceled
+	RequestTimeoutSeconds int `env:"REQUEST_TIMEOUT_SECONDS" yaml:"request_timeout_seconds" toml:"request_timeout_seconds" validate:"min=1"`
+}
+
+// IsProduction reports whether the application runs in production, e.g. for Secure cookies
+func (c AppConfig) IsProduction() bool {
+	return c.Env == "production"
+}
+
+// IsLocal reports whether the application runs in development or tests, the only environments that
+// may serve local stand-ins such as the mock OIDC provider
+func (c AppConfig) IsLocal() bool {
+	return c.Env == "development" || c.Env == "test"
+}
+
+type LogConfig struct {
+	Level  string `env:"LOG_LEVEL" yaml:"level" toml:"level" validate:"oneof=debug info warn error"`
+	Format string `env:"LOG_FORMAT" yaml:"format" toml:"format" validate:"oneof=json text"`
+}
+
+type CORSConfig struct {
+	AllowedOrigins []string `env:"CORS_ALLOWED_ORIGINS" yaml:"allowed_origins" toml:"allowed_origins" validate:"min=1,dive,required"`
+}
+
+type DBConfig struct {
+	Driver   string `env:"DB_DRIVER" yaml:"driver" toml:"driver" validate:"oneof=mysql postgres sqlite"`
+	User     string `env:"DB_USER" yaml:"user" toml:"user" validate:"required_unless=Driver sqlite"`
+	Password string `env:"DB_PASSWORD" yaml:"password" toml:"password"`
+	Host     string `env:"DB_HOST" yaml:"host" toml:"host" validate:"required_unless=Driver sqlite"`
+	Port     int    `env:"DB_PORT" yaml:"port" toml:"port" validate:"omitempty,min=1,max=65535"` // 0 selects the default port of the driver
+	Name     string `env:"DB_NAME" yaml:"name" toml:"name" validate:"required"`                  // Database name, or the database file for sqlite
+	SSLMode  string `env:"DB_SSL_MODE" yaml:"ssl_mode" toml:"ssl_mode"`                          // sslmode of postgres, e.g. disable or require
+	// Read replicas as driver specific DSNs, e.g. "user:pass@tcp(host:3306)/gobete?parseTime=True" for mysql
+	ReplicaDSNs []string `env:"DB_REPLICA_DSNS" yaml:"replica_dsns" toml:"replica_dsns" validate:"dive,required"`
+	// Refuse to start while migrations embedded in the binary are not applied
+	RequireMigrated bool `env:"DB_REQUIRE_MIGRATED" yaml:"require_migrated" toml:"require_migrated"`
+	// Connection pool, 0 means no limit
+	MaxOpenConns           int `env:"DB_MAX_OPEN_CONNS" yaml:"max_open_conns" toml:"max_open_conns" validate:"min=0"`
+	MaxIdleConns           int `env:"DB_MAX_IDLE_CONNS" yaml:"max_idle_conns" toml:"max_idle_conns" validate:"min=0"`
+	ConnMaxLifetimeSeconds int `env:"DB_CONN_MAX_LIFETIME_SECONDS" yaml:"conn_max_lifetime_seconds" toml:"conn_max_lifetime_seconds" validate:"min=0"`
+	ConnMaxIdleTimeSeconds int `env:"DB_CONN_MAX_IDLE_TIME_SECONDS" yaml:"conn_max_idle_time_seconds" toml:"conn_max_idle_time_seconds" validate:"min=0"`
+	// Startup retries when the database is not reachable yet, the delay doubles after every attempt
+	ConnectRetries           int `env:"DB_CONNECT_RETRIES" yaml:"connect_retries" toml:"connect_retries" validate:"min=0"`
+	ConnectRetryDelaySeconds int `env:"DB_CONNECT_RETRY_DELAY_SECONDS" yaml:"connect_retry_delay_seconds" toml:"connect_retry_delay_seconds" validate:"min=1"`
+}
+
+type JWTConfig struct {
+	Algorithm                string   `env:"JWT_ALGORITHM" yaml:"algorithm" toml:"algorithm" validate:"oneof=HS256 RS256 ES256 EdDSA"`
+	Secret                   string   `env:"JWT_SECRET" yaml:"secret" toml:"secret" validate:"required_if=Algorithm HS256"`
+	KeyID                    string   `env:"JWT_KEY_ID" yaml:"key_id" toml:"key_id"`
+	PrivateKeyFile           string   `env:"JWT_PRIVATE_KEY_FILE" yaml:"private_key_file" toml:"private_key_file" validate:"required_unless=Algorithm HS256"`
+	VerificationKeyFiles     []string `env:"JWT_VERIFICATION_KEY_FILES" yaml:"verification_key_files" toml:"verification_key_files"` // Previous keys, as "kid=path" or "path", PEM keys or HS256 secrets
+	Issuer                   string   `env:"JWT_ISSUER" yaml:"issuer" toml:"issuer" validate:"required"`
+	Audience                 []string `env:"JWT_AUDIENCE" yaml:"audience" toml:"audience" validate:"min=1,dive,required"`
+	AccessTokenExpireMinutes int      `env:"ACCESS_TOKEN_EXPIRE_MINUTES" yaml:"access_token_expire_minutes" toml:"access_token_expire_minutes" validate:"min=1"`
+	RefreshTokenExpireDays   int      `env:"REFRESH_TOKEN_EXPIRE_DAYS" yaml:"refresh_token_expire_days" toml:"refresh_token_expire_days" validate:"min=1"`
+	MFATokenExpireMinutes    int      `env:"MFA_TOKEN_EXPIRE_MINUTES" yaml:"mfa_token_expire_minutes" toml:"mfa_token_expire_minutes" validate:"min=1"`
+	LeewaySeconds            int      `env:"JWT_LEEWAY_SECONDS" yaml:"leeway_seconds" toml:"leeway_seconds" validate:"min=0"`
+}
+
+type SessionConfig struct {
+	Mode                   string            `env:"SESSION_MODE" yaml:"mode" toml:"mode" validate:"oneof=jwt_stateless jwt_server_stateful"`
+	RefreshTokenTransports map[string]string `env:"REFRESH_TOKEN_TRANSPORTS" yaml:"refresh_token_transports" toml:"refresh_token_transports" validate:"dive,keys,required,endkeys,oneof=cookie body"` // Client type to transport
+}
+
+// Stateful reports whether refresh tokens are backed by the user_sessions table
+func (c SessionConfig) Stateful() bool {
+	return c.Mode == SessionModeStateful
+}
+
+type RevocationConfig struct {
+	Store string `env:"REVOCATION_STORE" yaml:"store" toml:"store" validate:"oneof=memory database"`
+}
+
+type LoginConfig struct {
+	MaxAttempts          int    `env:"LOGIN_MAX_ATTEMPTS" yaml:"max_attempts" toml:"max_attempts" validate:"min=1"`
+	MaxAttemptsPerIP     int    `env:"LOGIN_MAX_ATTEMPTS_PER_IP" yaml:"max_attempts_per_ip" toml:"max_attempts_per_ip" validate:"min=1"`
+	LockoutSeconds       int    `env:"LOGIN_LOCKOUT_SECONDS" yaml:"lockout_seconds" toml:"lockout_seconds" validate:"min=1"`
+	LockoutMaxSeconds    int    `env:"LOGIN_LOCKOUT_MAX_SECONDS" yaml:"lockout_max_seconds" toml:"lockout_max_seconds" validate:"gtefield=LockoutSeconds"`
+	AttemptWindowMinutes int    `env:"LOGIN_ATTEMPT_WINDOW_MINUTES" yaml:"attempt_window_minutes" toml:"attempt_window_minutes" validate:"min=1"`
+	LockoutResponse      string `env:"LOGIN_LOCKOUT_RESPONSE" yaml:"lockout_response" toml:"lockout_response" validate:"oneof=locked generic"`
+}
+
+type MFAConfig struct {
+	Issuer string `env:"MFA_ISSUER" yaml:"issuer" toml:"issuer" validate:"required"`
+}
+
+type APIKeyConfig struct {
+	DefaultExpireDays int `env:"API_KEY_DEFAULT_EXPIRE_DAYS" yaml:"default_expire_days" toml:"default_expire_days" validate:"min=1,max=365"`
+}
+
+type EmailVerificationConfig struct {
+	Policy                string `env:"EMAIL_VERIFICATION_POLICY" yaml:"policy" toml:"policy" validate:"oneof=off restrict require"`
+	TokenExpireHours      int    `env:"EMAIL_VERIFICATION_TOKEN_EXPIRE_HOURS" yaml:"token_expire_hours" toml:"token_expire_hours" validate:"min=1"`
+	ResendCooldownSeconds int    `env:"EMAIL_VERIFICATION_RESEND_COOLDOWN_SECONDS" yaml:"resend_cooldown_seconds" toml:"resend_cooldown_seconds" validate:"min=0"`
+	URL                   string `env:"EMAIL_VERIFICATION_URL" yaml:"url" toml:"url" validate:"url"`
+}
+
+type PasswordResetConfig struct {
+	TokenExpireMinutes int    `env:"PASSWORD_RESET_TOKEN_EXPIRE_MINUTES" yaml:"token_expire_minutes" toml:"token_expire_minutes" validate:"min=1"`
+	URL                string `env:"PASSWORD_RESET_URL" yaml:"url" toml:"url" validate:"url"`
+}
+
+type MailConfig struct {
+	Driver       string `env:"MAIL_DRIVER" yaml:"driver" toml:"driver" validate:"oneof=smtp file memory"`
+	From         string `env:"MAIL_FROM" yaml:"from" toml:"from" validate:"required_if=Driver smtp"`
+	SMTPHost     string `env:"MAIL_SMTP_HOST" yaml:"smtp_host" toml:"smtp_host" validate:"required_if=Driver smtp"`
+	SMTPPort     int    `env:"MAIL_SMTP_PORT" yaml:"smtp_port" toml:"smtp_port" validate:"min=1,max=65535"`
+	SMTPUsername string `env:"MAIL_SMTP_USERNAME" yaml:"smtp_username" toml:"smtp_username"`
+	SMTPPassword string `env:"MAIL_SMTP_PASSWORD" yaml:"smtp_password" toml:"smtp_password"`
+	FileDir      string `env:"MAIL_FILE_DIR" yaml:"file_dir" toml:"file_dir" validate:"required_if=Driver file"`
+}
+
+// OIDCConfig lists the OpenID Connect providers by name. From the environment the names are read from
+// OIDC_PROVIDERS (comma separated) and every provider from OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID,
+// OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL and OIDC_<NAME>_SCOPES (space separated).
+type OIDCConfig struct {
+	Providers   map[string]OIDCProviderConfig `yaml:"providers" toml:"providers" validate:"dive"`
+	LinkByEmail bool                          `env:"OIDC_LINK_BY_EMAIL" yaml:"link_by_email" toml:"link_by_email"`
+	MockServer  bool                          `env:"OIDC_MOCK_SERVER" yaml:"mock_server" toml:"mock_server"` // Only allowed in development and test
+	MockIssuer  string                        `env:"OIDC_MOCK_ISSUER" yaml:"mock_issuer" toml:"mock_issuer" validate:"required_if=MockServer true,omitempty,url"`
+}
+
+type OIDCProviderConfig struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer" validate:"required,url"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" validate:"required"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" validate:"required,url"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"` // Defaults to "openid email profile"
+}
+
+// Default returns the configuration used for every setting that is not configured
+func Default() *Config {
+	return &Config{
+		App:  AppConfig{Env: "development", Port: 9000, RequestTimeoutSeconds: 30},
+		Log:  LogConfig{Level: "info", Format: "json"},
+		CORS: CORSConfig{AllowedOrigins: []string{"http://localhost:5173"}},
+		DB: DBConfig{
+			Driver:                   "mysql",
+			MaxOpenConns:             25,
+			MaxIdleConns:             10,
+			ConnMaxLifetimeSeconds:   300,
+			ConnMaxIdleTimeSeconds:   60,
+			ConnectRetries:           5,
+			ConnectRetryDelaySeconds: 1,
+		},
+		JWT: JWTConfig{
+			Algorithm:                "HS256",
+			Issuer:                   "gobete",
+			Audience:                 []string{"gobete"},
+			AccessTokenExpireMinutes: 15,
+			RefreshTokenExpireDays:   7,
+			MFATokenExpireMinutes:    5,
+			LeewaySeconds:            30,
+		},
+		Session: SessionConfig{
+			Mode:                   SessionModeStateless,
+			RefreshTokenTransports: map[string]string{"web": "cookie", "mobile": "body"},
+		},
+		Revocation: RevocationConfig{Store: "memory"},
+		Login: LoginConfig{
+			MaxAttempts:          5,
+			MaxAttemptsPerIP:     20,
+			LockoutSeconds:       60,
+			LockoutMaxSeconds:    3600,
+			AttemptWindowMinutes: 15,
+			LockoutResponse:      "locked",
+		},
+		MFA:    MFAConfig{Issuer: "gobete"},
+		APIKey: APIKeyConfig{DefaultExpireDays: 90},
+		EmailVerification: EmailVerificationConfig{
+			Policy:                "off",
+			TokenExpireHours:      24,
+			ResendCooldownSeconds: 60,
+			URL:                   "http://localhost:5173/verify-email",
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenExpireMinutes: 60,
+			URL:                "http://localhost:5173/reset-password",
+		},
+		Mail: MailConfig{Driver: "memory", SMTPPort: 587, FileDir: "tmp/mails"},
+		OIDC: OIDCConfig{LinkByEmail: true},
+	}
+}
+
+// Load reads the .env file if there is one, then the config file of CONFIG_FILE if set, then the
+// environment, and validates the result. Env variables override the config file.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("config: loading .env: %w", err)
+	}
+
+	cfg := Default()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, fmt.Errorf("config: loading %s: %w", path, err)
+		}
+	}
+
+	// Report unparsable env variables together with the other problems
+	problems := loadEnv(cfg)
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, err.(*ValidationError).Problems...)
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return nil, &ValidationError{Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// Validate checks every setting and reports all problems at once
+func (c *Config) Validate() error {
+	var problems []string
+	if err := validate.Struct(c); err != nil {
+		problems = validationProblems(err)
+	}
+	// The mock provider signs any email as verified, it must never be reachable outside of local setups
+	if c.OIDC.MockServer && !c.App.IsLocal() {
+		problems = append(problems, fmt.Sprintf("OIDC_MOCK_SERVER is only allowed when ENV is development or test, got %q", c.App.Env))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	slices.Sort(problems)
+	return &ValidationError{Problems: problems}
+}
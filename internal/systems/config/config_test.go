@@ -0,0 +1,164 @@
+package config
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// validConfig returns the defaults with the settings that have no default
+func validConfig() *Config {
+	cfg := Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.DB.Driver = "sqlite"
+	cfg.DB.Name = "gobete.db"
+	return cfg
+}
+
+func TestValidateMockServerOnlyLocally(t *testing.T) {
+	for env, wantAllowed := range map[string]bool{
+		"development": true,
+		"test":        true,
+		"staging":     false,
+		"production":  false,
+	} {
+		cfg := validConfig()
+		cfg.App.Env = env
+		cfg.OIDC.MockServer = true
+		cfg.OIDC.MockIssuer = "http://localhost:9000/oidc-mock"
+
+		err := cfg.Validate()
+		if allowed := err == nil; allowed != wantAllowed {
+			t.Errorf("ENV %s: Validate() = %v, want allowed %v", env, err, wantAllowed)
+		}
+		if err != nil && !strings.Contains(err.Error(), "OIDC_MOCK_SERVER") {
+			t.Errorf("ENV %s: Validate() = %v, want a problem of OIDC_MOCK_SERVER", env, err)
+		}
+	}
+}
+
+// loadIn runs Load in an empty directory, so no .env file is read
+func loadIn(t *testing.T) (*Config, error) {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	return Load()
+}
+
+func TestLoadEnv(t *testing.T) {
+	t.Setenv("JWT_SECRET", "env-secret")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_NAME", "gobete.db")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "3")
+	t.Setenv("OIDC_LINK_BY_EMAIL", "false")
+	t.Setenv("JWT_AUDIENCE", "gobete, ,admin")
+	t.Setenv("REFRESH_TOKEN_TRANSPORTS", "Web:body, mobile : cookie")
+	t.Setenv("OIDC_PROVIDERS", "Google")
+	t.Setenv("OIDC_GOOGLE_ISSUER", "https://accounts.google.com")
+	t.Setenv("OIDC_GOOGLE_CLIENT_ID", "client")
+	t.Setenv("OIDC_GOOGLE_REDIRECT_URL", "http://localhost:5173/oauth/google")
+	t.Setenv("OIDC_GOOGLE_SCOPES", "openid email")
+
+	cfg, err := loadIn(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.JWT.Secret != "env-secret" || cfg.Login.MaxAttempts != 3 || cfg.OIDC.LinkByEmail {
+		t.Errorf("JWT_SECRET, LOGIN_MAX_ATTEMPTS, OIDC_LINK_BY_EMAIL = %q %d %v, want env-secret 3 false", cfg.JWT.Secret, cfg.Login.MaxAttempts, cfg.OIDC.LinkByEmail)
+	}
+	if !slices.Equal(cfg.JWT.Audience, []string{"gobete", "admin"}) {
+		t.Errorf("JWT_AUDIENCE = %v, want [gobete admin]", cfg.JWT.Audience)
+	}
+	if want := map[string]string{"web": "body", "mobile": "cookie"}; !maps.Equal(cfg.Session.RefreshTokenTransports, want) {
+		t.Errorf("REFRESH_TOKEN_TRANSPORTS = %v, want %v", cfg.Session.RefreshTokenTransports, want)
+	}
+	google, ok := cfg.OIDC.Providers["google"]
+	if !ok || google.ClientID != "client" || !slices.Equal(google.Scopes, []string{"openid", "email"}) {
+		t.Errorf("OIDC providers = %+v, want google with client ID and scopes", cfg.OIDC.Providers)
+	}
+	// Unset variables keep their defaults
+	if cfg.App.Port != Default().App.Port {
+		t.Errorf("APP_PORT = %d, want the default %d", cfg.App.Port, Default().App.Port)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	files := map[string]string{
+		"gobete.yaml": "app:\n  port: 8080\ndb:\n  driver: sqlite\n  name: file.db\njwt:\n  secret: file-secret\n",
+		"gobete.toml": "[app]\nport = 8080\n\n[db]\ndriver = \"sqlite\"\nname = \"file.db\"\n\n[jwt]\nsecret = \"file-secret\"\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+		t.Setenv("JWT_SECRET", "env-secret") // Env variables override the file
+
+		cfg, err := loadIn(t)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.App.Port != 8080 || cfg.DB.Name != "file.db" || cfg.JWT.Secret != "env-secret" {
+			t.Errorf("%s: port, db name, secret = %d %q %q, want 8080 file.db env-secret", name, cfg.App.Port, cfg.DB.Name, cfg.JWT.Secret)
+		}
+	}
+}
+
+func TestLoadExampleConfigFile(t *testing.T) {
+	path, err := filepath.Abs("../../../config.example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	if _, err := loadIn(t); err != nil {
+		t.Errorf("config.example.yaml: %v", err)
+	}
+}
+
+func TestLoadFileRefusesUnknownKeys(t *testing.T) {
+	files := map[string]string{
+		"typo.yaml":   "jwt:\n  secert: file-secret\n",
+		"typo.toml":   "[jwt]\nsecert = \"file-secret\"\n",
+		"gobete.json": "{}",
+	}
+	for name, content := range files {
+		path := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv("CONFIG_FILE", path)
+
+		if _, err := loadIn(t); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("%s: Load() = %v, want an error loading the file", name, err)
+		}
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_NAME", "gobete.db")
+	t.Setenv("LOGIN_MAX_ATTEMPTS", "many")
+	t.Setenv("SESSION_MODE", "cookies")
+	t.Setenv("REFRESH_TOKEN_TRANSPORTS", "web")
+
+	_, err := loadIn(t)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Load() = %v, want a ValidationError", err)
+	}
+	want := []string{
+		`JWT_SECRET is required when JWT_ALGORITHM is HS256`,
+		`LOGIN_MAX_ATTEMPTS: "many" is not a number`,
+		`REFRESH_TOKEN_TRANSPORTS: "web" is not a key:value pair`,
+		`SESSION_MODE must be one of jwt_stateless, jwt_server_stateful, got "cookies"`,
+	}
+	if !slices.Equal(validationErr.Problems, want) {
+		t.Errorf("problems = %q, want %q", validationErr.Problems, want)
+	}
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// loadEnv overrides the configuration with the env variables of the env tags and returns the variables
+// that cannot be parsed. Unset and empty variables keep the value of the defaults or the config file.
+func loadEnv(cfg *Config) []string {
+	var problems []string
+	setFromEnv(reflect.ValueOf(cfg).Elem(), &problems)
+	loadOIDCEnv(&cfg.OIDC)
+	return problems
+}
+
+func setFromEnv(v reflect.Value, problems *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		name, ok := t.Field(i).Tag.Lookup("env")
+		if !ok {
+			if field.Kind() == reflect.Struct {
+				setFromEnv(field, problems)
+			}
+			continue
+		}
+
+		value := strings.TrimSpace(os.Getenv(name))
+		if value == "" {
+			continue
+		}
+		if err := setValue(field, value); err != nil {
+			*problems = append(*problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+}
+
+// setValue parses an env variable into a field. Lists are comma separated, maps are comma separated key:value pairs.
+func setValue(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", value)
+		}
+		field.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not true or false", value)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		field.Set(reflect.ValueOf(splitList(value)))
+	case reflect.Map:
+		pairs := map[string]string{}
+		for _, pair := range splitList(value) {
+			key, val, found := strings.Cut(pair, ":")
+			if !found {
+				return fmt.Errorf("%q is not a key:value pair", pair)
+			}
+			pairs[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+		field.Set(reflect.ValueOf(pairs))
+	default:
+		panic("config: unsupported field type " + field.Type().String())
+	}
+	return nil
+}
+
+// loadOIDCEnv reads the providers listed in OIDC_PROVIDERS, which replaces the list of the config file.
+// Settings of a provider can come from the file and be overridden by its env variables, e.g. the client secret.
+func loadOIDCEnv(cfg *OIDCConfig) {
+	providers := map[string]OIDCProviderConfig{}
+	for name, provider := range cfg.Providers {
+		providers[strings.ToLower(name)] = provider
+	}
+	if names := strings.TrimSpace(os.Getenv("OIDC_PROVIDERS")); names != "" {
+		listed := map[string]OIDCProviderConfig{}
+		for _, name := range splitList(strings.ToLower(names)) {
+			listed[name] = providers[name]
+		}
+		providers = listed
+	}
+
+	for name, provider := range providers {
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		setStringFromEnv(&provider.Issuer, prefix+"ISSUER")
+		setStringFromEnv(&provider.ClientID, prefix+"CLIENT_ID")
+		setStringFromEnv(&provider.ClientSecret, prefix+"CLIENT_SECRET")
+		setStringFromEnv(&provider.RedirectURL, prefix+"REDIRECT_URL")
+		if scopes := strings.Fields(os.Getenv(prefix + "SCOPES")); len(scopes) > 0 {
+			provider.Scopes = scopes
+		}
+		providers[name] = provider
+	}
+	cfg.Providers = providers
+}
+
+func setStringFromEnv(s *string, name string) {
+	if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+		*s = value
+	}
+}
+
+// splitList splits a comma separated list, dropping empty entries
+func splitList(value string) []string {
+	list := []string{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"github.com/go-playground/validator/v10"
+
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by env variable, or by config file key for fields without one
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		if name := field.Tag.Get("env"); name != "" {
+			return name
+		}
+		return field.Tag.Get("yaml")
+	})
+	return v
+}
+
+// ValidationError lists every problem of a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+func validationProblems(err error) []string {
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return []string{err.Error()}
+	}
+
+	problems := make([]string, len(validationErrors))
+	for i, fe := range validationErrors {
+		problems[i] = problemMessage(fe)
+	}
+	return problems
+}
+
+func problemMessage(fe validator.FieldError) string {
+	name := fieldName(fe)
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", name)
+	case "required_if", "required_unless":
+		otherField, value, _ := strings.Cut(fe.Param(), " ")
+		condition := "is"
+		if fe.Tag() == "required_unless" {
+			condition = "is not"
+		}
+		return fmt.Sprintf("%s is required when %s %s %s", name, siblingName(fe, otherField), condition, value)
+	case "oneof":
+		return fmt.Sprintf("%s must be one of %s, got %q", name, strings.ReplaceAll(fe.Param(), " ", ", "), fmt.Sprint(fe.Value()))
+	case "min":
+		if fe.Kind() == reflect.Slice {
+			return fmt.Sprintf("%s must not be empty", name)
+		}
+		return fmt.Sprintf("%s must be at least %s, got %v", name, fe.Param(), fe.Value())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s, got %v", name, fe.Param(), fe.Value())
+	case "gtefield":
+		return fmt.Sprintf("%s must be greater than or equal to %s", name, siblingName(fe, fe.Param()))
+	case "url":
+		return fmt.Sprintf("%s must be a valid URL, got %q", name, fmt.Sprint(fe.Value()))
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address, got %q", name, fmt.Sprint(fe.Value()))
+	default:
+		return fmt.Sprintf("%s is invalid (%s)", name, fe.Tag())
+	}
+}
+
+// fieldName is the env variable of a field, or its config file path like oidc.providers[google].issuer
+func fieldName(fe validator.FieldError) string {
+	path := strings.TrimPrefix(fe.Namespace(), "Config.")
+	if field := fe.Field(); field != "" && unicode.IsUpper(rune(field[0])) {
+		return field
+	}
+
+	// Provider settings also have an env variable, derived from the provider name
+	if provider, ok := strings.CutPrefix(path, "oidc.providers["); ok {
+		name, key, _ := strings.Cut(provider, "].")
+		return fmt.Sprintf("%s (OIDC_%s_%s)", path, strings.ToUpper(name), strings.ToUpper(key))
+	}
+	return path
+}
+
+// siblingName returns the env variable of another field of the same struct, for cross field rules
+func siblingName(fe validator.FieldError, goField string) string {
+	t := reflect.TypeOf(Config{})
+	parts := strings.Split(fe.StructNamespace(), ".")
+	for _, part := range parts[1 : len(parts)-1] {
+		field, ok := t.FieldByName(part)
+		if !ok || field.Type.Kind() != reflect.Struct {
+			return goField
+		}
+		t = field.Type
+	}
+
+	if field, ok := t.FieldByName(goField); ok {
+		if name := field.Tag.Get("env"); name != "" {
+			return name
+		}
+	}
+	return goField
+}
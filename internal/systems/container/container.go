@@ -0,0 +1,88 @@
+package container
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/health"
+	"github.com/sonyarianto/gobete/internal/systems/logging"
+	"github.com/sonyarianto/gobete/internal/systems/mailer"
+	"github.com/sonyarianto/gobete/internal/systems/oidc"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+	"gorm.io/gorm"
+
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Container holds the dependencies shared by the modules. It is built once in main and
+// passed to http.NewApp, tests can build their own with a separate database or clock.
+type Container struct {
+	Config      *config.Config
+	DB          *gorm.DB
+	Keys        *signing.KeyManager
+	Tokens      *token.Service
+	Revocations revocation.Store
+	Mailer      mailer.Mailer
+	OIDC        oidc.Providers
+	Clock       func() time.Time // Time of the modules, the token service and the OIDC clients
+	Logger      *slog.Logger     // Adds the request ID and user ID of the context passed to the *Context methods
+	Health      *health.Registry // Checks of /readyz, modules can register their own
+}
+
+// New builds the container of the configuration on top of an open database connection
+func New(cfg *config.Config, db *gorm.DB) (*Container, error) {
+	logger := logging.New(cfg.Log, os.Stderr)
+
+	// Load the JWT signing and verification keys
+	keys, err := signing.NewKeyManagerFromConfig(cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load JWT keys: %w", err)
+	}
+
+	// Initialize the token revocation store
+	revocations, err := revocation.NewStore(cfg.Revocation, db)
+	if err != nil {
+		return nil, err
+	}
+
+	// Initialize the mailer
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := mail.(*mailer.MemoryMailer); ok {
+		logger.Warn("Using in-memory mailer, emails will not be delivered")
+	}
+
+	tokens := token.NewService(keys, cfg.JWT)
+
+	// The application is only ready while the database answers
+	checks := health.NewRegistry()
+	checks.Register("database", health.Database(db))
+
+	deps := &Container{
+		Config:      cfg,
+		DB:          db,
+		Keys:        keys,
+		Tokens:      tokens,
+		Revocations: revocations,
+		Mailer:      mail,
+		OIDC:        oidc.NewProviders(cfg.OIDC),
+		Clock:       time.Now,
+		Logger:      logger,
+		Health:      checks,
+	}
+
+	// The token service and the OIDC clients read the container clock, so replacing Clock in a
+	// test moves the time of the whole application
+	now := func() time.Time { return deps.Clock() }
+	tokens.Now = now
+	for _, provider := range deps.OIDC {
+		provider.Now = now
+	}
+
+	return deps, nil
+}
@@ -0,0 +1,48 @@
+package container
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+
+	"testing"
+	"time"
+)
+
+func TestClockDrivesTokensAndOIDCClients(t *testing.T) {
+	cfg := config.Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.OIDC.Providers = map[string]config.OIDCProviderConfig{"mock": {Issuer: "http://localhost:9000/mock-oidc", ClientID: "gobete"}}
+
+	deps, err := New(cfg, nil) // No query reaches the database
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Replaced after New, like tests do
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	deps.Clock = func() time.Time { return now }
+
+	if got := deps.Tokens.Now(); !got.Equal(now) {
+		t.Errorf("token service time = %v, want %v", got, now)
+	}
+	if got := deps.OIDC["mock"].Now(); !got.Equal(now) {
+		t.Errorf("OIDC client time = %v, want %v", got, now)
+	}
+
+	accessToken, claims, err := deps.Tokens.IssueAccessToken(token.Claims{UserID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.IssuedAt.Time.Equal(now) {
+		t.Errorf("issued at = %v, want %v", claims.IssuedAt.Time, now)
+	}
+
+	// Valid at the container time, expired once the clock moves past the access token lifetime
+	if _, err := deps.Tokens.ParseAccessToken(accessToken); err != nil {
+		t.Errorf("ParseAccessToken at issue time: %v", err)
+	}
+	now = now.Add(deps.Tokens.AccessTokenTTL + deps.Tokens.Leeway + time.Second)
+	if _, err := deps.Tokens.ParseAccessToken(accessToken); err == nil {
+		t.Error("ParseAccessToken accepted an expired token")
+	}
+}
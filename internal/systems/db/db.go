@@ -0,0 +1,120 @@
+package db
+
+import (
+	"github.com/glebarez/sqlite"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// Drivers supported by Connect, selected with DB_DRIVER
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+// Longest wait between two connection attempts on startup
+const maxRetryDelay = 30 * time.Second
+
+// Queries taking longer are logged as slow
+const slowQueryThreshold = 200 * time.Millisecond
+
+// Connect opens the database of the configuration with the driver selected by DB_DRIVER. While the
+// database is not reachable, e.g. when it starts together with the application, it retries
+// DB_CONNECT_RETRIES times with a delay doubling from DB_CONNECT_RETRY_DELAY_SECONDS.
+func Connect(cfg config.DBConfig) (*gorm.DB, error) {
+	delay := time.Duration(cfg.ConnectRetryDelaySeconds) * time.Second
+	for attempt := 1; ; attempt++ {
+		db, err := open(cfg)
+		if err == nil {
+			return db, nil
+		}
+		if attempt > cfg.ConnectRetries {
+			return nil, fmt.Errorf("failed to connect database after %d attempts: %w", attempt, err)
+		}
+
+		slog.Warn("Failed to connect database, retrying", "attempt", attempt, "attempts", cfg.ConnectRetries+1, "delay", delay.String(), "error", err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// open makes a single connection attempt and configures the connection pool
+func open(cfg config.DBConfig) (*gorm.DB, error) {
+	var dsn string
+	switch cfg.Driver {
+	case MySQL, "":
+		dsn = mysqlDSN(cfg)
+	case Postgres:
+		dsn = postgresDSN(cfg)
+	case SQLite:
+		dsn = sqliteDSN(cfg)
+	}
+	dialector, err := dialector(cfg.Driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// GORM pings the database on open, so an unreachable database fails here. Its slow queries and
+	// errors go to the application logger, with the request ID of the query context.
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: logger.NewSlogLogger(slog.Default(), logger.Config{
+			SlowThreshold:             slowQueryThreshold,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	})
+	if err != nil {
+		if db != nil {
+			if sqlDB, dbErr := db.DB(); dbErr == nil {
+				sqlDB.Close()
+			}
+		}
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	configurePool(sqlDB, cfg)
+	return db, nil
+}
+
+// dialector selects the GORM driver of DB_DRIVER for a DSN
+func dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case MySQL, "":
+		return mysql.Open(dsn), nil
+	case Postgres:
+		return postgres.Open(dsn), nil
+	case SQLite:
+		return sqlite.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+}
+
+// configurePool applies the connection pool settings, to the primary and to every replica
+func configurePool(sqlDB *sql.DB, cfg config.DBConfig) {
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(time.Duration(cfg.ConnMaxLifetimeSeconds) * time.Second)
+	sqlDB.SetConnMaxIdleTime(time.Duration(cfg.ConnMaxIdleTimeSeconds) * time.Second)
+}
+
+// port returns the configured port, or the default port of the driver
+func port(cfg config.DBConfig, defaultPort int) int {
+	if cfg.Port == 0 {
+		return defaultPort
+	}
+	return cfg.Port
+}
@@ -1,29 +1,13 @@
 package db
 
 import (
-	"fmt"
-	"log"
-	"os"
+	"github.com/sonyarianto/gobete/internal/systems/config"
 
-	"gorm.io/driver/mysql"
-	"gorm.io/gorm"
+	"fmt"
 )
 
-var DB *gorm.DB
-
-func ConnectMySQL() {
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	dbname := os.Getenv("DB_NAME")
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		user, password, host, port, dbname)
-
-	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{})
-	if err != nil {
-		log.Fatal("failed to connect database: ", err)
-	}
-	DB = db
+// mysqlDSN builds the MySQL DSN of the configuration
+func mysqlDSN(cfg config.DBConfig) string {
+	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+		cfg.User, cfg.Password, cfg.Host, port(cfg, 3306), cfg.Name)
 }
@@ -0,0 +1,24 @@
+package db
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// postgresDSN builds the PostgreSQL connection URL of the configuration. The URL form
+// escapes passwords with spaces or quotes, which the key=value form does not.
+func postgresDSN(cfg config.DBConfig) string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   net.JoinHostPort(cfg.Host, strconv.Itoa(port(cfg, 5432))),
+		Path:   "/" + cfg.Name,
+	}
+	if cfg.SSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+	return dsn.String()
+}
@@ -0,0 +1,216 @@
+package db
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"gorm.io/gorm"
+
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// How often replicas are pinged, an unhealthy replica gets reads again after a successful ping
+const replicaCheckInterval = 5 * time.Second
+
+// database/sql driver names registered by the GORM drivers
+var sqlDriverNames = map[string]string{
+	MySQL:    "mysql",
+	"":       "mysql",
+	Postgres: "pgx",
+	SQLite:   "sqlite",
+}
+
+type stickyKey struct{}
+
+// sticky records whether a write was made with a context, reads of that context then use the primary
+type sticky struct {
+	written atomic.Bool
+}
+
+// ReadYourWrites returns a context whose reads go to the primary once it was used for a write, so
+// a request reads its own writes even while the replicas lag behind. Installed per request.
+func ReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, stickyKey{}, &sticky{})
+}
+
+// Primary returns a context whose reads always go to the primary, for reads that must not be stale
+func Primary(ctx context.Context) context.Context {
+	s := &sticky{}
+	s.written.Store(true)
+	return context.WithValue(ctx, stickyKey{}, s)
+}
+
+type replica struct {
+	name    string // "replica 1", the DSN holds the password
+	pool    *sql.DB
+	healthy atomic.Bool
+}
+
+type replicaSet struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+// Replicas are the read replicas in use, see UseReplicas
+type Replicas struct {
+	set  *replicaSet
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// UseReplicas opens the replicas of DB_REPLICA_DSNS and routes the reads of db to them, round robin.
+// Transactions, locking reads and reads after a write with a ReadYourWrites context stay on the
+// primary, and reads fall back to the primary while no replica is healthy. It returns nil without
+// replicas, otherwise the caller closes the replicas on shutdown.
+func UseReplicas(db *gorm.DB, cfg config.DBConfig) (*Replicas, error) {
+	if len(cfg.ReplicaDSNs) == 0 {
+		return nil, nil
+	}
+
+	driverName, ok := sqlDriverNames[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
+
+	// Replicas only need a connection pool, which connects lazily, so a replica that is down
+	// does not stop the startup and gets reads once it answers the health check
+	set := &replicaSet{primary: db.ConnPool}
+	for i, dsn := range cfg.ReplicaDSNs {
+		pool, err := sql.Open(driverName, dsn)
+		if err != nil {
+			set.close()
+			return nil, fmt.Errorf("failed to open replica %d: %w", i+1, err)
+		}
+		configurePool(pool, cfg)
+
+		// Starts healthy, so the first check logs a replica that is down
+		replica := &replica{name: fmt.Sprintf("replica %d", i+1), pool: pool}
+		replica.healthy.Store(true)
+		set.replicas = append(set.replicas, replica)
+	}
+
+	if err := registerCallbacks(db, set); err != nil {
+		set.close()
+		return nil, err
+	}
+
+	set.checkHealth()
+	replicas := &Replicas{set: set, stop: make(chan struct{})}
+	replicas.wg.Add(1)
+	go func() {
+		defer replicas.wg.Done()
+		ticker := time.NewTicker(replicaCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				set.checkHealth()
+			case <-replicas.stop:
+				return
+			}
+		}
+	}()
+
+	return replicas, nil
+}
+
+// registerCallbacks routes reads before they run, and marks the context as written after writes
+func registerCallbacks(db *gorm.DB, set *replicaSet) error {
+	if err := db.Callback().Query().Before("gorm:query").Register("gobete:route_read", set.routeRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("gobete:route_read", set.routeRead); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("gobete:mark_written", markWritten); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("gobete:mark_written", markWritten); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("gobete:mark_written", markWritten); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("gobete:mark_written", markWritten)
+}
+
+// Check reports an error while no replica is healthy. Reads still work then, all of them on the
+// primary, so it is an informational check that must not make the instance unready.
+func (r *Replicas) Check(context.Context) error {
+	for _, replica := range r.set.replicas {
+		if replica.healthy.Load() {
+			return nil
+		}
+	}
+	return errors.New("no healthy database replica")
+}
+
+// Close stops the health checks and closes the replica connection pools. Reads must not run anymore,
+// call it after the server stopped.
+func (r *Replicas) Close() error {
+	close(r.stop)
+	r.wg.Wait()
+	return r.set.close()
+}
+
+// close closes the connection pools of the replicas
+func (s *replicaSet) close() error {
+	var errs []error
+	for _, replica := range s.replicas {
+		errs = append(errs, replica.pool.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// checkHealth pings every replica and logs when one goes down or comes back
+func (s *replicaSet) checkHealth() {
+	for _, replica := range s.replicas {
+		ctx, cancel := context.WithTimeout(context.Background(), replicaCheckInterval)
+		err := replica.pool.PingContext(ctx)
+		cancel()
+
+		if healthy := err == nil; replica.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.Info("Database replica is healthy, routing reads to it", "replica", replica.name)
+			} else {
+				slog.Warn("Database replica is unhealthy, not routing reads to it", "replica", replica.name, "error", err)
+			}
+		}
+	}
+}
+
+// routeRead sends a read to the next healthy replica, unless it has to see the primary
+func (s *replicaSet) routeRead(db *gorm.DB) {
+	// Statement.ConnPool is the transaction inside Transaction, reads there stay on the primary
+	if db.Statement.ConnPool != s.primary {
+		return
+	}
+	if _, locking := db.Statement.Clauses["FOR"]; locking {
+		return
+	}
+	if sticky, ok := db.Statement.Context.Value(stickyKey{}).(*sticky); ok && sticky.written.Load() {
+		return
+	}
+
+	start := s.next.Add(1)
+	for i := range uint64(len(s.replicas)) {
+		replica := s.replicas[(start+i)%uint64(len(s.replicas))]
+		if replica.healthy.Load() {
+			db.Statement.ConnPool = replica.pool
+			return
+		}
+	}
+}
+
+// markWritten makes the following reads of a ReadYourWrites context use the primary
+func markWritten(db *gorm.DB) {
+	if sticky, ok := db.Statement.Context.Value(stickyKey{}).(*sticky); ok {
+		sticky.written.Store(true)
+	}
+}
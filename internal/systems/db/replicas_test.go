@@ -0,0 +1,137 @@
+package db
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+type item struct {
+	ID   uint
+	Name string
+}
+
+// newReplicatedDB opens a SQLite primary and replica, each holding an item named after it, so a
+// read shows where it was routed
+func newReplicatedDB(t *testing.T) (*gorm.DB, *Replicas) {
+	t.Helper()
+
+	dir := t.TempDir()
+	cfg := config.DBConfig{Driver: SQLite, Name: filepath.Join(dir, "primary.db"), ConnectRetryDelaySeconds: 1}
+	replicaCfg := cfg
+	replicaCfg.Name = filepath.Join(dir, "replica.db")
+
+	replica := openItems(t, replicaCfg, "replica")
+	sqlDB, _ := replica.DB()
+	sqlDB.Close()
+
+	db := openItems(t, cfg, "primary")
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	cfg.ReplicaDSNs = []string{sqliteDSN(replicaCfg)}
+	replicas, err := UseReplicas(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { replicas.Close() })
+	return db, replicas
+}
+
+// openItems opens the database and stores an item with the name
+func openItems(t *testing.T, cfg config.DBConfig, name string) *gorm.DB {
+	t.Helper()
+
+	db, err := Connect(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&item{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&item{Name: name}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// readFrom returns the name of the first item, "primary" or "replica"
+func readFrom(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+
+	var first item
+	if err := db.Order("id").First(&first).Error; err != nil {
+		t.Fatal(err)
+	}
+	return first.Name
+}
+
+func TestReadsGoToReplicas(t *testing.T) {
+	db, _ := newReplicatedDB(t)
+	ctx := context.Background()
+
+	if got := readFrom(t, db.WithContext(ctx)); got != "replica" {
+		t.Errorf("read = %s, want replica", got)
+	}
+	if got := readFrom(t, db.WithContext(Primary(ctx))); got != "primary" {
+		t.Errorf("read with a Primary context = %s, want primary", got)
+	}
+	if got := readFrom(t, db.WithContext(ctx).Clauses(clause.Locking{Strength: "UPDATE"})); got != "primary" {
+		t.Errorf("locking read = %s, want primary", got)
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if got := readFrom(t, tx); got != "primary" {
+			t.Errorf("read in a transaction = %s, want primary", got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	db, _ := newReplicatedDB(t)
+	ctx := ReadYourWrites(context.Background())
+
+	if got := readFrom(t, db.WithContext(ctx)); got != "replica" {
+		t.Errorf("read before a write = %s, want replica", got)
+	}
+	if err := db.WithContext(ctx).Create(&item{Name: "written"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := readFrom(t, db.WithContext(ctx)); got != "primary" {
+		t.Errorf("read after a write = %s, want primary", got)
+	}
+
+	// Other contexts keep reading from the replicas
+	if got := readFrom(t, db.WithContext(ReadYourWrites(context.Background()))); got != "replica" {
+		t.Errorf("read of another request = %s, want replica", got)
+	}
+}
+
+func TestReadsFallBackToPrimary(t *testing.T) {
+	db, replicas := newReplicatedDB(t)
+
+	if err := replicas.Check(t.Context()); err != nil {
+		t.Fatalf("Check with a healthy replica: %v", err)
+	}
+
+	// A replica that stops answering its ping gets no reads
+	replicas.set.replicas[0].pool.Close()
+	replicas.set.checkHealth()
+
+	if got := readFrom(t, db.WithContext(context.Background())); got != "primary" {
+		t.Errorf("read without a healthy replica = %s, want primary", got)
+	}
+	if err := replicas.Check(t.Context()); err == nil {
+		t.Error("Check succeeded without a healthy replica")
+	}
+}
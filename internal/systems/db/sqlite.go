@@ -0,0 +1,18 @@
+package db
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"strings"
+)
+
+// sqliteDSN points to the database file named by DB_NAME. Foreign keys are off by default in
+// SQLite and are turned on, the busy timeout lets concurrent writers wait instead of failing.
+// SQLite ignores SELECT ... FOR UPDATE, so transactions take the write lock when they begin.
+func sqliteDSN(cfg config.DBConfig) string {
+	separator := "?"
+	if strings.Contains(cfg.Name, "?") {
+		separator = "&"
+	}
+	return cfg.Name + separator + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+}
@@ -4,6 +4,7 @@ var ErrorMessages = map[string]string{
 	"not_found":                    "Resource not found.",
 	"invalid_payload":              "Invalid request payload.",
 	"unauthorized":                 "Invalid email or password.",
+	"forbidden":                    "You do not have permission to access this resource.",
 	"invalid_credentials":          "Invalid email or password.",
 	"validation_error":             "Validation error.",
 	"user_exists":                  "User already exists.",
@@ -20,5 +21,33 @@ var ErrorMessages = map[string]string{
 	"refresh_session_not_found":    "Refresh session not found.",
 	"user_not_found":               "User not found.",
 	"user_detail_not_found":        "User detail not found.",
+	"invalid_current_password":     "Current password is incorrect.",
+	"password_unchanged":           "New password must be different from the current password.",
+	"invalid_role":                 "One or more roles do not exist.",
+	"invalid_reset_token":          "Password reset token is invalid or has expired.",
+	"invalid_verification_token":   "Email verification token is invalid or has expired.",
+	"email_not_verified":           "Email address is not verified.",
+	"too_many_requests":            "Too many requests. Please try again later.",
+	"refresh_token_reused":         "Refresh token was already used. All sessions of this login have been revoked, please log in again.",
+	"session_not_found":            "Session not found.",
+	"sessions_not_supported":       "Session management requires the jwt_server_stateful session mode.",
+	"invalid_mfa_token":            "MFA token is invalid or expired. Please log in again.",
+	"invalid_mfa_code":             "MFA code is invalid or was already used.",
+	"mfa_already_enabled":          "Two-factor authentication is already enabled.",
+	"mfa_not_enabled":              "Two-factor authentication is not enabled.",
+	"mfa_setup_required":           "Start the two-factor authentication setup first.",
+	"too_many_login_attempts":      "Too many failed login attempts. Please try again later.",
+	"unknown_provider":             "Unknown identity provider.",
+	"oauth_provider_error":         "The identity provider could not be reached or refused the request.",
+	"invalid_oauth_state":          "Sign in request is invalid or has expired. Please try again.",
+	"invalid_id_token":             "The identity provider returned an invalid ID token.",
+	"account_exists":               "An account with this email already exists. Log in and link the provider from your account.",
+	"oauth_email_required":         "The identity provider did not share an email address.",
+	"identity_already_linked":      "This provider account is already linked to another user.",
+	"identity_not_found":           "Identity not found.",
+	"api_key_not_found":            "API key not found.",
+	"api_key_not_allowed":          "API keys cannot be used for this action. Please log in with your password.",
+	"invalid_scope":                "The requested scope is not allowed.",
+	"not_ready":                    "Service is not ready. Please try again later.",
 	// Add more error codes and messages as needed
 }
@@ -0,0 +1,102 @@
+package health
+
+import (
+	"gorm.io/gorm"
+
+	"context"
+	"sync"
+	"time"
+)
+
+// Time a single check may take before the dependency counts as unavailable
+const checkTimeout = 2 * time.Second
+
+// Check returns an error when a dependency cannot serve requests
+type Check func(ctx context.Context) error
+
+// Report is the outcome of the checks, "ok" or the error message by check name. Informational checks
+// are reported without affecting Ready.
+type Report struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Registry holds the dependency checks behind the readiness endpoint. Modules can register
+// their own checks, e.g. for an external service they cannot work without.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]registeredCheck
+}
+
+type registeredCheck struct {
+	check         Check
+	informational bool
+}
+
+// NewRegistry creates a registry without checks, which is always ready
+func NewRegistry() *Registry {
+	return &Registry{checks: map[string]registeredCheck{}}
+}
+
+// Register adds a check, replacing a previous check of the same name
+func (r *Registry) Register(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = registeredCheck{check: check}
+}
+
+// RegisterInformational adds a check that is reported but never makes the instance unready, for
+// degraded states the instance still serves requests in, which would otherwise fail every instance
+// at once
+func (r *Registry) RegisterInformational(name string, check Check) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = registeredCheck{check: check, informational: true}
+}
+
+// Run executes every check concurrently, each with its own timeout
+func (r *Registry) Run(ctx context.Context) Report {
+	r.mu.RLock()
+	checks := make(map[string]registeredCheck, len(r.checks))
+	for name, check := range r.checks {
+		checks[name] = check
+	}
+	r.mu.RUnlock()
+
+	report := Report{Ready: true, Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			result := "ok"
+			if err := check.check(checkCtx); err != nil {
+				result = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result != "ok" && !check.informational {
+				report.Ready = false
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+// Database checks that the database answers a ping
+func Database(db *gorm.DB) Check {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
@@ -0,0 +1,42 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	failing := func(context.Context) error { return errors.New("down") }
+	passing := func(context.Context) error { return nil }
+
+	tests := []struct {
+		name      string
+		register  func(*Registry)
+		wantReady bool
+	}{
+		{"no checks", func(*Registry) {}, true},
+		{"passing check", func(r *Registry) { r.Register("database", passing) }, true},
+		{"failing check", func(r *Registry) { r.Register("database", failing) }, false},
+		{"failing informational check", func(r *Registry) {
+			r.Register("database", passing)
+			r.RegisterInformational("database_replicas", failing)
+		}, true},
+	}
+	for _, tt := range tests {
+		registry := NewRegistry()
+		tt.register(registry)
+
+		report := registry.Run(t.Context())
+		if report.Ready != tt.wantReady {
+			t.Errorf("%s: ready = %v, want %v", tt.name, report.Ready, tt.wantReady)
+		}
+	}
+
+	// Informational results are still reported
+	registry := NewRegistry()
+	registry.RegisterInformational("database_replicas", failing)
+	if got := registry.Run(t.Context()).Checks["database_replicas"]; got != "down" {
+		t.Errorf("informational check = %q, want down", got)
+	}
+}
@@ -2,20 +2,29 @@ package http
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/sonyarianto/gobete/internal/systems/container"
+	"github.com/sonyarianto/gobete/internal/systems/http/middleware"
+
+	"time"
 )
 
-func NewApp() *fiber.App {
+// NewApp creates the Fiber app serving the modules wired with the dependencies of the container
+func NewApp(deps *container.Container) (*fiber.App, error) {
 	app := fiber.New()
 
 	// Global middlewares
-	app.Use(logger.New())
+	app.Use(middleware.RequestID())
+	app.Use(middleware.RequestLogger(deps.Logger))
+	app.Use(middleware.RequestTimeout(time.Duration(deps.Config.App.RequestTimeoutSeconds) * time.Second))
+	app.Use(middleware.ReadYourWrites())
 
 	// Register all routes
-	RegisterRoutes(app)
+	if err := RegisterRoutes(app, deps); err != nil {
+		return nil, err
+	}
 
 	// 404 handler
 	app.Use(NotFoundHandler)
 
-	return app
+	return app, nil
 }
@@ -1,7 +1,9 @@
 package http
 
 import (
+	"github.com/sonyarianto/gobete/internal/systems/health"
 	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -11,6 +13,30 @@ func NotFoundHandler(c *fiber.Ctx) error {
 	return response.SendErrorResponse(c, fiber.StatusNotFound, "not_found")
 }
 
-func HealthCheckHandler(c *fiber.Ctx) error {
-	return response.SendSuccessResponse(c, "API is healthy", fiber.Map{"status": "healthy"})
+// JWKSHandler publishes the public keys used to verify access tokens, so other services
+// can verify gobete tokens without sharing a secret
+func JWKSHandler(keys *signing.KeyManager) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.JSON(keys.JWKS())
+	}
+}
+
+// LivenessHandler reports that the process is running, without checking dependencies, so an
+// orchestrator does not restart the application while the database is down
+func LivenessHandler(c *fiber.Ctx) error {
+	return response.SendSuccessResponse(c, "API is alive", fiber.Map{"status": "alive"})
+}
+
+// ReadinessHandler runs the registered dependency checks and fails with 503 while any of them
+// fails, so a load balancer stops sending traffic to the instance. Informational checks are only
+// reported.
+func ReadinessHandler(checks *health.Registry) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report := checks.Run(c.UserContext())
+		if !report.Ready {
+			return response.SendErrorResponse(c, fiber.StatusServiceUnavailable, "not_ready", report.Checks)
+		}
+		return response.SendSuccessResponse(c, "API is ready", fiber.Map{"status": "ready", "checks": report.Checks})
+	}
 }
@@ -1,22 +1,40 @@
 package middleware
 
 import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/sonyarianto/gobete/internal/modules/user"
+	"github.com/sonyarianto/gobete/internal/systems/container"
 	"github.com/sonyarianto/gobete/internal/systems/db"
+	"github.com/sonyarianto/gobete/internal/systems/logging"
 	"github.com/sonyarianto/gobete/internal/systems/response"
+	"github.com/sonyarianto/gobete/internal/systems/revocation"
+	"github.com/sonyarianto/gobete/internal/systems/token"
 
-	"fmt"
-	"os"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"slices"
 	"strings"
 	"time"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+// Longest incoming X-Request-ID that is kept, longer ones are replaced by a generated ID
+const maxRequestIDLength = 128
+
+// Middleware builds the handlers that need the application dependencies
+type Middleware struct {
+	*container.Container
+	Users *user.Service
+}
+
+// New creates the middleware of the container, authenticating API keys with the user service
+func New(c *container.Container, users *user.Service) *Middleware {
+	return &Middleware{Container: c, Users: users}
+}
 
-func JWTProtected() fiber.Handler {
+func (m *Middleware) JWTProtected() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -24,47 +42,70 @@ func JWTProtected() fiber.Handler {
 		}
 
 		accessTokenString := strings.TrimPrefix(authHeader, "Bearer ")
-		accessToken, err := jwt.Parse(accessTokenString, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "Unexpected signing method")
+
+		// API keys of scripts and CI jobs get the same principal as a login, with the key scopes as permissions
+		if strings.HasPrefix(accessTokenString, user.APIKeyPrefix) {
+			claims, err := m.Users.AuthenticateAPIKey(c.UserContext(), accessTokenString, c.IP())
+			if err == user.ErrInvalidAPIKey {
+				return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
+			}
+			if err != nil {
+				return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to check API key")
 			}
-			return jwtSecret, nil
-		})
 
-		if err != nil || !accessToken.Valid {
+			c.Locals("user", claims)
+			c.SetUserContext(logging.WithUserID(c.UserContext(), claims.UserID))
+			return c.Next()
+		}
+
+		claims, err := m.Tokens.ParseAccessToken(accessTokenString)
+		if err != nil {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
 		}
 
-		c.Locals("user", accessToken)
+		// Refuse tokens revoked by logout, password change or admin actions
+		revoked, err := revocation.IsRevoked(c.UserContext(), m.Revocations, claims)
+		if err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to check token revocation")
+		}
+		if revoked {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
+		}
+
+		c.Locals("user", claims)
+		c.SetUserContext(logging.WithUserID(c.UserContext(), claims.UserID))
 		return c.Next()
 	}
 }
 
-func UserSessionCheck() fiber.Handler {
+func (m *Middleware) UserSessionCheck() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Only check session if SESSION_MODE is "jwt_server_stateful"
-		if os.Getenv("SESSION_MODE") != "jwt_server_stateful" {
+		if !m.Config.Session.Stateful() {
+			return c.Next()
+		}
+
+		// API keys have no refresh token cookie, revoking the key ends its access
+		if user.IsAPIKeyPrincipal(c) {
 			return c.Next()
 		}
 
-		// Try to get refresh_token from cookie
-		refreshToken := c.Cookies("refresh_token")
+		// Get the refresh token from the cookie or the X-Refresh-Token header, depending on the client type
+		refreshToken := m.Users.RefreshTokenFromRequest(c)
 		if refreshToken == "" {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "session_expired")
 		}
 
-		token, err := jwt.Parse(refreshToken, func(token *jwt.Token) (any, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fiber.NewError(fiber.StatusUnauthorized, "Unexpected signing method")
-			}
-			return jwtSecret, nil
-		})
-		if err != nil || !token.Valid {
+		claims, err := m.Tokens.ParseRefreshToken(refreshToken)
+		if err != nil {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "session_expired")
 		}
 
-		claims := token.Claims.(jwt.MapClaims)
-		if !isValidUserSession(claims) {
+		valid, err := m.isValidUserSession(c, claims)
+		if err != nil {
+			return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to check session")
+		}
+		if !valid {
 			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "session_expired")
 		}
 
@@ -72,41 +113,199 @@ func UserSessionCheck() fiber.Handler {
 	}
 }
 
+// DenyAPIKeys refuses requests authenticated with an API key, for account security actions that
+// need an interactive login. Must be used after JWTProtected.
+func DenyAPIKeys() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if user.IsAPIKeyPrincipal(c) {
+			return response.SendErrorResponse(c, fiber.StatusForbidden, "api_key_not_allowed")
+		}
+		return c.Next()
+	}
+}
+
+// AdminOnly allows the request only if the authenticated user has the admin role.
 func AdminOnly() fiber.Handler {
-	// TODO: Implement admin check logic
+	return RequireRole(user.RoleAdmin)
+}
+
+// RequireRole allows the request if the authenticated user has at least one of the given roles.
+// Must be used after JWTProtected.
+func RequireRole(roles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(*token.Claims)
+		if !ok {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
+		}
+
+		for _, role := range roles {
+			if slices.Contains(claims.Roles, role) {
+				return c.Next()
+			}
+		}
+
+		return response.SendErrorResponse(c, fiber.StatusForbidden, "forbidden")
+	}
+}
+
+// RequirePermission allows the request only if the authenticated user has all of the given permissions.
+// Must be used after JWTProtected.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals("user").(*token.Claims)
+		if !ok {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
+		}
+
+		for _, permission := range permissions {
+			if !slices.Contains(claims.Permissions, permission) {
+				return response.SendErrorResponse(c, fiber.StatusForbidden, "forbidden")
+			}
+		}
+
 		return c.Next()
 	}
 }
 
-func isValidUserSession(claims jwt.MapClaims) bool {
-	var userID string
-	switch v := claims["user_id"].(type) {
-	case string:
-		userID = v
-	case float64:
-		userID = fmt.Sprintf("%.0f", v) // JWT numbers are float64
-	default:
-		return false
+// RequireVerifiedEmail refuses users with an unverified email address when the email
+// verification policy is "restrict". Must be used after JWTProtected.
+func (m *Middleware) RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if m.Users.EmailVerificationPolicy() != user.EmailVerificationRestrict {
+			return c.Next()
+		}
+
+		claims, ok := c.Locals("user").(*token.Claims)
+		if !ok {
+			return response.SendErrorResponse(c, fiber.StatusUnauthorized, "unauthorized", "Unauthorized access - invalid or missing token.")
+		}
+
+		if !claims.EmailVerified {
+			return response.SendErrorResponse(c, fiber.StatusForbidden, "email_not_verified")
+		}
+
+		return c.Next()
+	}
+}
+
+// isValidUserSession checks that the refresh token belongs to an active session and refreshes its last seen time
+func (m *Middleware) isValidUserSession(c *fiber.Ctx, claims *token.Claims) (bool, error) {
+	session, err := m.Users.Sessions.FindByJTI(c.UserContext(), claims.ID)
+	if errors.Is(err, user.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if session.UserID != claims.UserID || session.RotatedAt != nil || !session.ExpiresAt.After(m.Clock()) {
+		return false, nil
+	}
+
+	// Update last seen at most once per minute, to avoid a write on every request
+	if m.Clock().Sub(session.LastSeenAt) > time.Minute {
+		m.Users.Sessions.Touch(c.UserContext(), session.ID, m.Clock(), c.IP())
+	}
+
+	return true, nil
+}
+
+// RequestTimeout gives every request a context with a deadline, which the handlers pass to database
+// queries and outbound calls. A handler failing because the deadline passed gets a consistent 504
+// request_timeout instead of its generic server error, one returning the error of canceled work,
+// e.g. of an upstream call, a 503 request_canceled. Both are sent once the handler returns, which
+// is soon after the deadline only when its work honours the context. fasthttp does not report
+// client disconnects, so a disconnect does not cancel the context.
+func RequestTimeout(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if ctxErr := ctx.Err(); ctxErr != nil && (err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError) {
+			return response.SendContextError(c, ctxErr)
+		}
+		if response.IsContextError(err) {
+			return response.SendContextError(c, err)
+		}
+		return err
+	}
+}
+
+// RequestID gives every request an ID, taken from X-Request-ID when the client or a proxy sent a
+// valid one. It is echoed in the X-Request-ID header and error responses, and added to every log
+// line of the request.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(fiber.HeaderXRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		c.Set(fiber.HeaderXRequestID, requestID)
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), requestID))
+		return c.Next()
 	}
+}
 
-	jti, ok := claims["jti"].(string)
-	if !ok {
+// validRequestID accepts IDs of letters, digits and "-_.:", nothing that could forge log lines
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
 		return false
 	}
+	for _, r := range requestID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("-_.:", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
 
-	var sessionCount int64
-	db.DB.Model(&user.UserSession{}).
-		Where("user_id = ? AND jti = ? AND expires_at > ?", userID, jti, time.Now()).
-		Count(&sessionCount)
+// RequestLogger logs every request once it is handled, with its status and duration. Errors
+// returned by the handlers are turned into their response first, so the logged status is the
+// one the client gets.
+func RequestLogger(logger *slog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
 
-	return sessionCount > 0
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		// The user context holds the user ID once JWTProtected authenticated the request
+		logger.Log(c.UserContext(), level, "Request handled",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"ip", c.IP(),
+		)
+		return nil
+	}
+}
+
+// ReadYourWrites makes the reads of a request go to the primary database once the request wrote
+// to it, so a handler reads back its own changes while the read replicas lag behind
+func ReadYourWrites() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(db.ReadYourWrites(c.UserContext()))
+		return c.Next()
+	}
 }
 
 func BodyParser(model any) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Create a new instance of the model type
-		req := model
+		// Create a new instance of the model type, so fields never leak between requests
+		req := reflect.New(reflect.TypeOf(model).Elem()).Interface()
 		if err := c.BodyParser(req); err != nil {
 			return response.SendErrorResponse(c, fiber.StatusBadRequest, "invalid_payload")
 		}
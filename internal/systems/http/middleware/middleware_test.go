@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/systems/response"
+
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestTimeout(50 * time.Millisecond))
+	app.Get("/fast", func(c *fiber.Ctx) error {
+		return c.SendString("done")
+	})
+	// Slow work honouring the context, like a database query
+	app.Get("/slow", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return c.UserContext().Err()
+	})
+	// A handler reporting the failed query as its own server error
+	app.Get("/slow-server-error", func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return response.SendErrorResponse(c, fiber.StatusInternalServerError, "db_error", "Failed to query users")
+	})
+	// Upstream work that was canceled before the deadline
+	app.Get("/canceled", func(c *fiber.Ctx) error {
+		return fmt.Errorf("calling the provider: %w", context.Canceled)
+	})
+
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"/fast", fiber.StatusOK, ""},
+		{"/slow", fiber.StatusGatewayTimeout, response.CodeRequestTimeout},
+		{"/slow-server-error", fiber.StatusGatewayTimeout, response.CodeRequestTimeout},
+		{"/canceled", fiber.StatusServiceUnavailable, response.CodeRequestCanceled},
+	}
+	for _, tt := range tests {
+		res, err := app.Test(httptest.NewRequest(fiber.MethodGet, tt.path, nil), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.path, res.StatusCode, tt.wantStatus)
+		}
+		if tt.wantCode != "" {
+			var body response.ErrorResponse
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Code != tt.wantCode {
+				t.Errorf("%s: code = %q, want %q", tt.path, body.Code, tt.wantCode)
+			}
+		}
+		res.Body.Close()
+	}
+}
@@ -2,24 +2,29 @@ package http
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
 	"github.com/sonyarianto/gobete/internal/modules/home"
 	"github.com/sonyarianto/gobete/internal/modules/user"
+	"github.com/sonyarianto/gobete/internal/systems/container"
 	"github.com/sonyarianto/gobete/internal/systems/http/middleware"
+	"github.com/sonyarianto/gobete/internal/systems/oidc"
+	"github.com/sonyarianto/gobete/internal/systems/response"
 
-	"os"
+	"fmt"
+	"strings"
 	"time"
 )
 
-func RegisterRoutes(app *fiber.App) {
-	allowedOrigins := "http://localhost:5173" // Default for development
-	if origins := os.Getenv("CORS_ALLOWED_ORIGINS"); origins != "" {
-		allowedOrigins = origins
-	}
+// RegisterRoutes registers the routes of every module
+func RegisterRoutes(app *fiber.App, deps *container.Container) error {
+	cfg := deps.Config
+
 	app.Use(cors.New(cors.Config{
-		AllowOrigins:     allowedOrigins, // or "*" for all origins (not recommended for production)
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins:     strings.Join(cfg.CORS.AllowedOrigins, ","), // or "*" for all origins (not recommended for production)
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-Client-Type, X-Refresh-Token, X-Request-ID",
+		ExposeHeaders:    "X-Request-ID",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
 		AllowCredentials: true,
 	}))
@@ -29,45 +34,104 @@ func RegisterRoutes(app *fiber.App) {
 		Max:        60,
 		Expiration: 60 * time.Second,
 		Next: func(c *fiber.Ctx) bool {
-			// Skip rate limiting for versioned /refresh and not versioned /healthz
-			return c.Path() == "/v1/refresh" || c.Path() == "/healthz"
+			// Skip rate limiting for versioned /refresh and not versioned health checks and JWKS
+			switch c.Path() {
+			case "/v1/refresh", "/livez", "/readyz", "/healthz", "/.well-known/jwks.json":
+				return true
+			}
+			return false
 		},
 	}))
 
-	app.Get("/healthz", HealthCheckHandler)
+	// Liveness and readiness probes, /healthz is kept for existing monitors and checks readiness
+	app.Get("/livez", LivenessHandler)
+	app.Get("/readyz", ReadinessHandler(deps.Health))
+	app.Get("/healthz", ReadinessHandler(deps.Health))
+	app.Get("/.well-known/jwks.json", JWKSHandler(deps.Keys))
+
+	// Local OpenID Connect provider for development, configure it as provider "mock" with the same OIDC_MOCK_ISSUER.
+	// It signs in anyone as any verified email, so it is only served in development and tests.
+	if cfg.OIDC.MockServer && cfg.App.IsLocal() {
+		mockProvider, err := oidc.NewMockProvider(cfg.OIDC.MockIssuer)
+		if err != nil {
+			return fmt.Errorf("failed to create mock OIDC provider: %w", err)
+		}
+		mockProvider.Now = func() time.Time { return deps.Clock() }
+		app.All("/oidc-mock/*", adaptor.HTTPHandler(mockProvider))
+	}
 
 	// Home route, without version prefix
-	app.Get("/", home.HomeHandler)
+	app.Get("/", home.NewService(deps).HomeHandler)
 
 	// Versioned API v1
 	apiV1 := app.Group("/v1")
-	RegisterAPIV1Routes(apiV1)
+	RegisterAPIV1Routes(apiV1, deps)
+	return nil
 }
 
 // RegisterAPIV1Routes handles all v1 routes
-func RegisterAPIV1Routes(api fiber.Router) {
+func RegisterAPIV1Routes(api fiber.Router, deps *container.Container) {
+	homes := home.NewService(deps)
+	users := user.NewService(deps)
+	mw := middleware.New(deps, users)
+
 	// Public routes
-	api.Get("/", home.HomeHandler)
-	api.Post("/login", middleware.BodyParser(&user.LoginRequest{}), user.LoginUserHandler)
-	api.Post("/users", middleware.BodyParser(&user.CreateUserRequest{}), user.CreateUserHandler)
-	api.Post("/refresh", user.RefreshTokenHandler)
+	api.Get("/", homes.HomeHandler)
+	api.Post("/login", middleware.BodyParser(&user.LoginRequest{}), users.LoginUserHandler)
+	api.Post("/login/mfa", limiter.New(limiter.Config{
+		Max:        5,
+		Expiration: 5 * time.Minute,
+		LimitReached: func(c *fiber.Ctx) error {
+			return response.SendErrorResponse(c, fiber.StatusTooManyRequests, "too_many_requests")
+		},
+	}), middleware.BodyParser(&user.LoginMFARequest{}), users.LoginMFAHandler)
+	api.Get("/oauth/:provider/authorize", users.OAuthAuthorizeHandler)
+	api.Post("/oauth/:provider/callback", middleware.BodyParser(&user.OAuthCallbackRequest{}), users.OAuthCallbackHandler)
+	api.Post("/users", middleware.BodyParser(&user.CreateUserRequest{}), users.CreateUserHandler)
+	api.Post("/refresh", users.RefreshTokenHandler)
+	api.Post("/password/forgot", middleware.BodyParser(&user.ForgotPasswordRequest{}), users.ForgotPasswordHandler)
+	api.Post("/password/reset", middleware.BodyParser(&user.ResetPasswordRequest{}), users.ResetPasswordHandler)
+	api.Get("/verify-email", users.VerifyEmailHandler)
+	api.Post("/verify-email", middleware.BodyParser(&user.VerifyEmailRequest{}), users.VerifyEmailHandler)
+	api.Post("/verify-email/resend", limiter.New(limiter.Config{
+		Max:        3,
+		Expiration: 15 * time.Minute,
+		LimitReached: func(c *fiber.Ctx) error {
+			return response.SendErrorResponse(c, fiber.StatusTooManyRequests, "too_many_requests")
+		},
+	}), middleware.BodyParser(&user.ResendVerificationEmailRequest{}), users.ResendVerificationEmailHandler)
 
 	// Protected user routes
-	protectedUser := api.Group("/users", middleware.JWTProtected(), middleware.UserSessionCheck())
+	protectedUser := api.Group("/users", mw.JWTProtected(), mw.UserSessionCheck())
 
-	// Current user routes
-	protectedUser.Get("/me", user.GetCurrentUserHandler)
-	protectedUser.Put("/me", user.UpdateCurrentUserHandler)
-	protectedUser.Put("/me/password", user.ChangePasswordHandler)
-	protectedUser.Delete("/me", user.DeleteCurrentUserHandler)
+	// Current user routes, API keys may read the account but every change needs an interactive login
+	protectedUser.Get("/me", users.GetCurrentUserHandler)
+	protectedUser.Put("/me", middleware.DenyAPIKeys(), mw.RequireVerifiedEmail(), middleware.BodyParser(&user.UpdateCurrentUserRequest{}), users.UpdateCurrentUserHandler)
+	protectedUser.Put("/me/password", middleware.DenyAPIKeys(), middleware.BodyParser(&user.ChangePasswordRequest{}), users.ChangePasswordHandler)
+	protectedUser.Delete("/me", middleware.DenyAPIKeys(), users.DeleteCurrentUserHandler)
+	protectedUser.Get("/me/sessions", middleware.DenyAPIKeys(), users.ListSessionsHandler)
+	protectedUser.Delete("/me/sessions", middleware.DenyAPIKeys(), users.RevokeOtherSessionsHandler)
+	protectedUser.Delete("/me/sessions/:id", middleware.DenyAPIKeys(), users.RevokeSessionHandler)
+	protectedUser.Get("/me/identities", middleware.DenyAPIKeys(), users.ListIdentitiesHandler)
+	protectedUser.Post("/me/identities/:provider", middleware.DenyAPIKeys(), users.LinkIdentityHandler)
+	protectedUser.Delete("/me/identities/:id", middleware.DenyAPIKeys(), users.UnlinkIdentityHandler)
+	protectedUser.Post("/me/mfa/setup", middleware.DenyAPIKeys(), users.SetupMFAHandler)
+	protectedUser.Post("/me/mfa/enable", middleware.DenyAPIKeys(), middleware.BodyParser(&user.MFACodeRequest{}), users.EnableMFAHandler)
+	protectedUser.Post("/me/mfa/disable", middleware.DenyAPIKeys(), middleware.BodyParser(&user.DisableMFARequest{}), users.DisableMFAHandler)
+	protectedUser.Post("/me/mfa/recovery-codes", middleware.DenyAPIKeys(), middleware.BodyParser(&user.MFACodeRequest{}), users.RegenerateRecoveryCodesHandler)
+	protectedUser.Get("/me/api-keys", middleware.DenyAPIKeys(), users.ListAPIKeysHandler)
+	protectedUser.Post("/me/api-keys", middleware.DenyAPIKeys(), middleware.BodyParser(&user.CreateAPIKeyRequest{}), users.CreateAPIKeyHandler)
+	protectedUser.Delete("/me/api-keys/:id", middleware.DenyAPIKeys(), users.RevokeAPIKeyHandler)
 
-	// Admin-only routes
-	adminUsers := protectedUser.Group("/", middleware.AdminOnly())
-	adminUsers.Get("/", user.ListUsersHandler)
-	adminUsers.Get("/:id", user.GetUserByIDHandler)
-	adminUsers.Put("/:id", user.UpdateUserByIDHandler)
-	adminUsers.Delete("/:id", user.DeleteUserByIDHandler)
+	// Admin-only routes, keep them after the current user routes because
+	// the admin group middleware applies to every path under /users
+	adminUsers := protectedUser.Group("/", middleware.AdminOnly(), mw.RequireVerifiedEmail())
+	adminUsers.Get("/", middleware.RequirePermission(user.PermissionUsersRead), users.ListUsersHandler)
+	adminUsers.Get("/:id", middleware.RequirePermission(user.PermissionUsersRead), users.GetUserByIDHandler)
+	adminUsers.Put("/:id", middleware.RequirePermission(user.PermissionUsersWrite), middleware.BodyParser(&user.AdminUpdateUserRequest{}), users.UpdateUserByIDHandler)
+	adminUsers.Delete("/:id", middleware.RequirePermission(user.PermissionUsersDelete), users.DeleteUserByIDHandler)
+	adminUsers.Post("/:id/unlock", middleware.RequirePermission(user.PermissionUsersWrite), users.UnlockUserHandler)
 
 	// Logout (protected)
-	api.Post("/logout", user.LogoutUserHandler)
+	api.Post("/logout", users.LogoutUserHandler)
 }
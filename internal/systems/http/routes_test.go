@@ -0,0 +1,131 @@
+package http
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/sonyarianto/gobete/internal/modules/user"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/container"
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"github.com/sonyarianto/gobete/internal/systems/migrate"
+	"golang.org/x/crypto/bcrypt"
+
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApp serves the routes on a migrated SQLite database, with the roles seeded and a verified user
+func newTestApp(t *testing.T, email, password string) *fiber.App {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.JWT.Secret = "test-secret"
+	cfg.DB = config.DBConfig{Driver: db.SQLite, Name: filepath.Join(t.TempDir(), "gobete.db"), ConnectRetryDelaySeconds: 1}
+
+	database, err := db.Connect(cfg.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+	migrator, err := migrate.New(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	deps, err := container.New(cfg, database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users := user.NewService(deps)
+	if err := users.SeedRoles(); err != nil {
+		t.Fatal(err)
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifiedAt := time.Now()
+	account := user.User{Email: email, Password: string(hashedPassword), EmailVerifiedAt: &verifiedAt}
+	if err := users.Users.Create(t.Context(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Users.CreateDetail(t.Context(), &user.UserDetail{UserID: account.ID, FirstName: "Jane", LastName: "Doe"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Roles.Assign(t.Context(), account.ID, user.RoleUser); err != nil {
+		t.Fatal(err)
+	}
+
+	app, err := NewApp(deps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app
+}
+
+// call sends a JSON request with the bearer credential and decodes the response
+func call(t *testing.T, app *fiber.App, method, path, bearer string, body any) (int, map[string]any) {
+	t.Helper()
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+bearer)
+	}
+	res, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var decoded map[string]any
+	json.NewDecoder(res.Body).Decode(&decoded)
+	return res.StatusCode, decoded
+}
+
+// API keys can read the account of their user, but no route under /v1/users/me changes it
+func TestAPIKeysCannotChangeTheirAccount(t *testing.T) {
+	app := newTestApp(t, "jane@example.com", "Secret123!")
+
+	status, body := call(t, app, fiber.MethodPost, "/v1/login", "", user.LoginRequest{Email: "jane@example.com", Password: "Secret123!"})
+	if status != fiber.StatusOK {
+		t.Fatalf("login status = %d (%v), want 200", status, body)
+	}
+	accessToken, _ := body["data"].(map[string]any)["access_token"].(string)
+
+	status, body = call(t, app, fiber.MethodPost, "/v1/users/me/api-keys", accessToken, user.CreateAPIKeyRequest{Name: "ci"})
+	if status != fiber.StatusOK {
+		t.Fatalf("create API key status = %d (%v), want 200", status, body)
+	}
+	apiKey, _ := body["data"].(map[string]any)["key"].(string)
+
+	if status, body := call(t, app, fiber.MethodGet, "/v1/users/me", apiKey, nil); status != fiber.StatusOK {
+		t.Errorf("GET /v1/users/me with an API key = %d (%v), want 200", status, body)
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if !strings.HasPrefix(route.Path, "/v1/users/me") || route.Method == fiber.MethodGet || route.Method == fiber.MethodHead {
+			continue
+		}
+		path := strings.NewReplacer(":id", "1", ":provider", "mock").Replace(route.Path)
+		status, body := call(t, app, route.Method, path, apiKey, map[string]string{"first_name": "Mallory"})
+		if status != fiber.StatusForbidden || body["code"] != "api_key_not_allowed" {
+			t.Errorf("%s %s with an API key = %d (%v), want 403 api_key_not_allowed", route.Method, path, status, body["code"])
+		}
+	}
+}
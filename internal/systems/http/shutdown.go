@@ -1,22 +1,23 @@
 package http
 
 import (
-	"log"
+	"github.com/gofiber/fiber/v2"
+
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
-
-	"github.com/gofiber/fiber/v2"
 )
 
-func WaitForShutdown(app *fiber.App) {
+func WaitForShutdown(app *fiber.App, logger *slog.Logger) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	logger.Info("Shutting down server...")
 
 	if err := app.Shutdown(); err != nil {
-		log.Fatalf("Error while shutting down server: %v", err)
+		logger.Error("Error while shutting down server", "error", err)
+		os.Exit(1)
 	}
-	log.Println("Server stopped")
+	logger.Info("Server stopped")
 }
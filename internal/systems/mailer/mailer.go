@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      []string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New creates the mailer implementation of MAIL_DRIVER.
+// Supported drivers are "smtp", "file" and "memory" (default).
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch driver := cfg.Driver; driver {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort), cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	case "file":
+		return NewFileMailer(cfg.FileDir, cfg.From), nil
+	case "", "memory":
+		return NewMemoryMailer(), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER: %s", driver)
+	}
+}
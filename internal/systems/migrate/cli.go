@@ -0,0 +1,128 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const usage = `usage: gobete migrate <command>
+
+commands:
+  up             apply all pending migrations
+  down [steps]   revert the last applied migration, or the given number of migrations
+  status         list migrations and whether they are applied
+  create <name>  create empty up and down files in ` + SourceDir + `/<dialect> for every dialect`
+
+var migrationNamePattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// Command runs the "gobete migrate" subcommand. The database is only connected for commands that need it.
+func Command(ctx context.Context, args []string, connect func() (*gorm.DB, error), out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+
+	// Create works on the source tree and needs no database
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New(usage)
+		}
+		// Every dialect gets the same version, so each database can be migrated to it
+		for _, dialect := range Dialects {
+			up, down, err := Create(filepath.Join(SourceDir, dialect), args[1])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Created %s\nCreated %s\n", up, down)
+		}
+		return nil
+	}
+
+	steps := 1
+	switch {
+	case args[0] == "down" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid number of steps: %s", args[1])
+		}
+		steps = n
+	case args[0] != "up" && args[0] != "down" && args[0] != "status", len(args) > 1:
+		return errors.New(usage)
+	}
+
+	db, err := connect()
+	if err != nil {
+		return err
+	}
+	migrator, err := New(db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "Nothing to migrate")
+		}
+		return err
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "Reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(reverted) == 0 {
+			fmt.Fprintln(out, "Nothing to revert")
+		}
+		return err
+	default:
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = "applied " + status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%-40s %s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	}
+}
+
+// Create writes empty up and down files for a new migration in dir, numbered after the last one
+func Create(dir, name string) (string, string, error) {
+	if !migrationNamePattern.MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name %q, use lowercase letters, digits and underscores", name)
+	}
+
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+	version := int64(1)
+	if len(migrations) > 0 {
+		version = migrations[len(migrations)-1].Version + 1
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("%04d_%s", version, name))
+	up, down := base+".up.sql", base+".down.sql"
+	if err := os.WriteFile(up, []byte("-- Write the schema change here\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(down, []byte("-- Revert the schema change of the up migration here\n"), 0o644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
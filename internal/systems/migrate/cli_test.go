@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"0001_create_a.up.sql", "0001_create_a.down.sql", "0007_create_b.up.sql", "0007_create_b.down.sql"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("-- empty\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	up, down, err := Create(dir, "add_phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "0008_add_phone.up.sql"); up != want {
+		t.Errorf("up file = %s, want %s", up, want)
+	}
+	if want := filepath.Join(dir, "0008_add_phone.down.sql"); down != want {
+		t.Errorf("down file = %s, want %s", down, want)
+	}
+	migrations, err := Load(os.DirFS(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 3 || migrations[2].Name != "add_phone" {
+		t.Errorf("migrations after Create = %+v, want add_phone last", migrations)
+	}
+
+	for _, name := range []string{"Add Phone", "add-phone", ""} {
+		if _, _, err := Create(dir, name); err == nil {
+			t.Errorf("Create(%q) succeeded, want an invalid name error", name)
+		}
+	}
+}
+
+func TestCommand(t *testing.T) {
+	database := newTestDB(t)
+	connected := 0
+	connect := func() (*gorm.DB, error) {
+		connected++
+		return database, nil
+	}
+	run := func(args ...string) (string, error) {
+		var out bytes.Buffer
+		err := Command(t.Context(), args, connect, &out)
+		return out.String(), err
+	}
+
+	// Usage errors are reported before connecting
+	for _, args := range [][]string{{}, {"sideways"}, {"up", "1"}, {"down", "0"}, {"down", "one"}, {"create"}} {
+		if _, err := run(args...); err == nil {
+			t.Errorf("migrate %v succeeded, want an error", args)
+		}
+	}
+	if connected != 0 {
+		t.Errorf("connected %d times for invalid commands, want 0", connected)
+	}
+
+	out, err := run("status")
+	if err != nil || strings.Contains(out, "applied") || !strings.Contains(out, "0001_create_users") {
+		t.Errorf("status before up = %q, %v, want every migration pending", out, err)
+	}
+	if out, err := run("up"); err != nil || !strings.HasPrefix(out, "Applied 0001_create_users\n") {
+		t.Errorf("up = %q, %v, want the applied migrations", out, err)
+	}
+	if out, err := run("up"); err != nil || out != "Nothing to migrate\n" {
+		t.Errorf("second up = %q, %v, want nothing to migrate", out, err)
+	}
+	if out, err := run("down", "2"); err != nil || strings.Count(out, "Reverted ") != 2 {
+		t.Errorf("down 2 = %q, %v, want two reverted migrations", out, err)
+	}
+	out, err = run("status")
+	if err != nil || strings.Count(out, "pending") != 2 || !strings.Contains(out, " applied ") {
+		t.Errorf("status after down = %q, %v, want two pending migrations", out, err)
+	}
+
+	failing := func() (*gorm.DB, error) { return nil, errors.New("database is gone") }
+	if err := Command(t.Context(), []string{"up"}, failing, &bytes.Buffer{}); err == nil || err.Error() != "database is gone" {
+		t.Errorf("up without a database = %v, want the connection error", err)
+	}
+}
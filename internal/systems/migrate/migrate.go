@@ -0,0 +1,295 @@
+package migrate
+
+import (
+	"gorm.io/gorm"
+
+	"cmp"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations
+var embedded embed.FS
+
+// Dialects with embedded migrations, one directory each. They match the GORM dialector names.
+var Dialects = []string{"mysql", "postgres", "sqlite"}
+
+// SourceDir is where "migrate create" writes new migrations, relative to the repository root
+const SourceDir = "internal/systems/migrate/migrations"
+
+// Migration files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+var fileNamePattern = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var ErrSchemaNotMigrated = errors.New("database schema is not migrated")
+
+// Migration is a versioned schema change with the SQL to apply and to revert it
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status of a migration, AppliedAt is nil for pending migrations
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// SchemaMigration is a row of the schema_migrations table, one per applied migration
+type SchemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:255"`
+	AppliedAt time.Time
+}
+
+// Migrator applies and reverts migrations, keeping track of them in schema_migrations
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	now        func() time.Time
+}
+
+// Embedded returns the migrations of a dialect compiled into the binary
+func Embedded(dialect string) ([]Migration, error) {
+	if !slices.Contains(Dialects, dialect) {
+		return nil, fmt.Errorf("no migrations for database dialect %q", dialect)
+	}
+	fsys, err := fs.Sub(embedded, "migrations/"+dialect)
+	if err != nil {
+		return nil, err
+	}
+	return Load(fsys)
+}
+
+// Load reads the migrations of a directory, ordered by version. Every version needs both an up and a down file.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, _ := strconv.ParseInt(match[1], 10, 64)
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, migration.Name, match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// New creates a migrator of the embedded migrations for the dialect of the database
+func New(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Embedded(db.Dialector.Name())
+	if err != nil {
+		return nil, err
+	}
+	return NewWithMigrations(db, migrations), nil
+}
+
+// NewWithMigrations creates a migrator of the given migrations
+func NewWithMigrations(db *gorm.DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations, now: time.Now}
+}
+
+// ensureTable creates the schema_migrations table on first use
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	db := m.db.WithContext(ctx)
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		return nil
+	}
+	return db.Migrator().CreateTable(&SchemaMigration{})
+}
+
+// applied returns the applied migrations by version, none if schema_migrations does not exist yet
+func (m *Migrator) applied(ctx context.Context) (map[int64]SchemaMigration, error) {
+	if !m.db.WithContext(ctx).Migrator().HasTable(&SchemaMigration{}) {
+		return map[int64]SchemaMigration{}, nil
+	}
+
+	var rows []SchemaMigration
+	if err := m.db.WithContext(ctx).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]SchemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// Status lists every migration with the time it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &row.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that are not applied yet
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order and returns the applied ones
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	if err := m.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, migration := range pending {
+		err := m.run(ctx, migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{Version: migration.Version, Name: migration.Name, AppliedAt: m.now()}).Error
+		})
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+// Down reverts the given number of most recently applied migrations and returns the reverted ones
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err := m.run(ctx, migration.Down, func(tx *gorm.DB) error {
+			return tx.Delete(&SchemaMigration{}, migration.Version).Error
+		})
+		if err != nil {
+			return reverted, fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+		}
+		reverted = append(reverted, migration)
+	}
+	return reverted, nil
+}
+
+// run executes the statements of a migration and records it in one transaction. MySQL commits
+// DDL statements implicitly, so a failing migration may be left partially applied there, while
+// PostgreSQL and SQLite roll it back completely.
+func (m *Migrator) run(ctx context.Context, sql string, record func(tx *gorm.DB) error) error {
+	return m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, statement := range splitStatements(sql) {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return record(tx)
+	})
+}
+
+// splitStatements splits a migration into statements. A statement ends with a semicolon at the
+// end of a line, lines starting with "--" are comments.
+func splitStatements(sql string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
+
+// CheckSchema returns ErrSchemaNotMigrated if migrations embedded in the binary were not applied
+func CheckSchema(ctx context.Context, db *gorm.DB) error {
+	migrator, err := New(db)
+	if err != nil {
+		return err
+	}
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%w: %d pending migrations, run \"gobete migrate up\"", ErrSchemaNotMigrated, len(pending))
+	}
+	return nil
+}
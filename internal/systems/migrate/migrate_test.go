@@ -0,0 +1,219 @@
+package migrate
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"gorm.io/gorm"
+
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestDB opens an empty SQLite database
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	database, err := db.Connect(config.DBConfig{Driver: db.SQLite, Name: filepath.Join(t.TempDir(), "gobete.db"), ConnectRetryDelaySeconds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+	return database
+}
+
+// tables lists the tables of a SQLite database
+func tables(t *testing.T, database *gorm.DB) []string {
+	t.Helper()
+
+	var names []string
+	if err := database.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name").Scan(&names).Error; err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func versions(migrations []Migration) []int64 {
+	var versions []int64
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"one statement", "CREATE TABLE a (id INT);", []string{"CREATE TABLE a (id INT);"}},
+		{
+			"statements over several lines",
+			"CREATE TABLE a (\n  id INT\n);\n\nCREATE INDEX idx_a ON a (id);\n",
+			[]string{"CREATE TABLE a (\n  id INT\n);", "CREATE INDEX idx_a ON a (id);"},
+		},
+		{"comments", "-- The a table\nCREATE TABLE a (id INT);\n  -- indented comment\n", []string{"CREATE TABLE a (id INT);"}},
+		{"semicolon inside a line", "INSERT INTO a (name) VALUES ('x;y');", []string{"INSERT INTO a (name) VALUES ('x;y');"}},
+		{"last statement without semicolon", "DROP TABLE a;\nDROP TABLE b", []string{"DROP TABLE a;", "DROP TABLE b"}},
+		{"only comments", "-- Nothing to do\n", nil},
+	}
+	for _, tt := range tests {
+		if got := splitStatements(tt.sql); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: splitStatements = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	migrations, err := Load(fstest.MapFS{
+		"0010_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INT);")},
+		"0010_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		"0002_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+		"0002_create_a.down.sql": {Data: []byte("DROP TABLE a;")},
+		"README.md":              {Data: []byte("Not a migration")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(migrations); !slices.Equal(got, []int64{2, 10}) {
+		t.Fatalf("versions = %v, want [2 10]", got)
+	}
+	if migrations[0].Name != "create_a" || migrations[0].Up != "CREATE TABLE a (id INT);" || migrations[0].Down != "DROP TABLE a;" {
+		t.Errorf("first migration = %+v, want create_a with its up and down SQL", migrations[0])
+	}
+
+	invalid := map[string]fstest.MapFS{
+		"missing down file": {"0001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id INT);")}},
+		"two names": {
+			"0001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INT);")},
+			"0001_create_b.down.sql": {Data: []byte("DROP TABLE b;")},
+		},
+	}
+	for name, fsys := range invalid {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: Load() succeeded, want an error", name)
+		}
+	}
+}
+
+// Every dialect must reach the same schema versions, so any database can be migrated to the binary
+func TestEmbeddedDialectsMatch(t *testing.T) {
+	want, err := Embedded(Dialects[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dialect := range Dialects[1:] {
+		migrations, err := Embedded(dialect)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(migrations) != len(want) {
+			t.Fatalf("%s has %d migrations, %s has %d", dialect, len(migrations), Dialects[0], len(want))
+		}
+		for i := range migrations {
+			if migrations[i].Version != want[i].Version || migrations[i].Name != want[i].Name {
+				t.Errorf("%s migration %04d_%s, %s has %04d_%s", dialect, migrations[i].Version, migrations[i].Name, Dialects[0], want[i].Version, want[i].Name)
+			}
+		}
+	}
+
+	if _, err := Embedded("oracle"); err == nil {
+		t.Error("Embedded(oracle) succeeded, want an error")
+	}
+}
+
+func TestUpDownAndCheckSchema(t *testing.T) {
+	database := newTestDB(t)
+	migrator, err := New(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CheckSchema(t.Context(), database); !errors.Is(err, ErrSchemaNotMigrated) {
+		t.Fatalf("CheckSchema on an empty database = %v, want %v", err, ErrSchemaNotMigrated)
+	}
+
+	applied, err := migrator.Up(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(migrator.migrations) {
+		t.Fatalf("Up applied %d migrations, want all %d", len(applied), len(migrator.migrations))
+	}
+	if again, err := migrator.Up(t.Context()); err != nil || len(again) != 0 {
+		t.Fatalf("second Up = %d migrations, %v, want none", len(again), err)
+	}
+	if err := CheckSchema(t.Context(), database); err != nil {
+		t.Fatalf("CheckSchema after Up = %v, want nil", err)
+	}
+	migratedTables := tables(t, database)
+
+	// Revert the last two migrations
+	last := migrator.migrations[len(migrator.migrations)-2:]
+	reverted, err := migrator.Down(t.Context(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := versions(reverted), []int64{last[1].Version, last[0].Version}; !slices.Equal(got, want) {
+		t.Errorf("Down(2) reverted %v, want %v", got, want)
+	}
+	statuses, err := migrator.Status(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range statuses {
+		if pending := status.AppliedAt == nil; pending != (i >= len(statuses)-2) {
+			t.Errorf("status of %04d_%s: pending = %v, want %v", status.Version, status.Name, pending, i >= len(statuses)-2)
+		}
+	}
+	if err := CheckSchema(t.Context(), database); !errors.Is(err, ErrSchemaNotMigrated) {
+		t.Errorf("CheckSchema after Down = %v, want %v", err, ErrSchemaNotMigrated)
+	}
+
+	// Every down migration drops what its up migration created
+	if _, err := migrator.Down(t.Context(), len(migrator.migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if got := tables(t, database); !slices.Equal(got, []string{"schema_migrations"}) {
+		t.Errorf("tables after reverting everything = %v, want only schema_migrations", got)
+	}
+	if _, err := migrator.Up(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := tables(t, database); !slices.Equal(got, migratedTables) {
+		t.Errorf("tables after migrating again = %v, want %v", got, migratedTables)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	database := newTestDB(t)
+	migrator := NewWithMigrations(database, []Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE a (id INT);", Down: "DROP TABLE a;"},
+		{Version: 2, Name: "create_b", Up: "CREATE TABLE b (id INT);\nCREATE TABLE broken (;", Down: "DROP TABLE b;"},
+	})
+
+	applied, err := migrator.Up(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "migration 2_create_b failed") {
+		t.Fatalf("Up = %v, want the failure of migration 2", err)
+	}
+	if got := versions(applied); !slices.Equal(got, []int64{1}) {
+		t.Errorf("Up applied %v, want [1]", got)
+	}
+	if got := tables(t, database); !slices.Equal(got, []string{"a", "schema_migrations"}) {
+		t.Errorf("tables after the failed migration = %v, want a and schema_migrations", got)
+	}
+	pending, err := migrator.Pending(t.Context())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(pending); !slices.Equal(got, []int64{2}) {
+		t.Errorf("pending after the failed migration = %v, want [2]", got)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `user_sessions`;
+DROP TABLE IF EXISTS `user_details`;
+DROP TABLE IF EXISTS `users`;
@@ -0,0 +1,45 @@
+CREATE TABLE `users` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  `deleted_at` datetime(3) NULL,
+  `email` varchar(191),
+  `password` longtext,
+  `email_verified_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_users_deleted_at` (`deleted_at`),
+  CONSTRAINT `uni_users_email` UNIQUE (`email`)
+);
+
+CREATE TABLE `user_details` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `first_name` longtext,
+  `last_name` longtext,
+  `phone` longtext,
+  `bio` longtext,
+  `avatar_url` longtext,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_user_details_user_id` (`user_id`)
+);
+
+CREATE TABLE `user_sessions` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `jti` varchar(36),
+  `family_id` varchar(36),
+  `parent_id` bigint unsigned,
+  `rotated_at` datetime(3) NULL,
+  `label` varchar(100),
+  `user_agent` longtext,
+  `ip_address` varchar(64),
+  `created_at` datetime(3) NULL,
+  `expires_at` datetime(3) NULL,
+  `last_seen_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_sessions_user_id` (`user_id`),
+  UNIQUE INDEX `idx_user_sessions_jti` (`jti`),
+  INDEX `idx_user_sessions_family_id` (`family_id`)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE `security_events` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `type` varchar(64),
+  `family_id` varchar(36),
+  `ip_address` varchar(64),
+  `user_agent` longtext,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_security_events_user_id` (`user_id`),
+  INDEX `idx_security_events_type` (`type`)
+);
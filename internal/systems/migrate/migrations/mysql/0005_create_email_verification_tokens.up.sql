@@ -0,0 +1,11 @@
+CREATE TABLE `email_verification_tokens` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `token_hash` varchar(64),
+  `expires_at` datetime(3) NULL,
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_email_verification_tokens_user_id` (`user_id`),
+  UNIQUE INDEX `idx_email_verification_tokens_token_hash` (`token_hash`)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE `revoked_tokens` (
+  `jti` varchar(36) NOT NULL,
+  `expires_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`jti`),
+  INDEX `idx_revoked_tokens_expires_at` (`expires_at`)
+);
+
+CREATE TABLE `token_revocations` (
+  `user_id` bigint unsigned NOT NULL,
+  `revoked_before` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`user_id`)
+);
@@ -0,0 +1,22 @@
+CREATE TABLE `user_mfas` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `secret` varchar(64),
+  `enabled_at` datetime(3) NULL,
+  `last_used_step` bigint,
+  `created_at` datetime(3) NULL,
+  `updated_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_user_mfas_user_id` (`user_id`)
+);
+
+CREATE TABLE `mfa_recovery_codes` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `code_hash` varchar(64),
+  `used_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_mfa_recovery_codes_user_id` (`user_id`),
+  UNIQUE INDEX `idx_mfa_recovery_codes_code_hash` (`code_hash`)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE `login_throttles` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `throttle_key` varchar(320),
+  `failures` bigint,
+  `last_failure_at` datetime(3) NULL,
+  `locked_until` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_login_throttles_throttle_key` (`throttle_key`),
+  INDEX `idx_login_throttles_last_failure_at` (`last_failure_at`)
+);
@@ -0,0 +1,26 @@
+CREATE TABLE `user_identities` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `provider` varchar(64),
+  `subject` varchar(255),
+  `email` longtext,
+  `created_at` datetime(3) NULL,
+  `last_login_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_user_identities_user_id` (`user_id`),
+  UNIQUE INDEX `idx_user_identities_provider_subject` (`provider`, `subject`)
+);
+
+CREATE TABLE `oauth_states` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `state_hash` varchar(64),
+  `provider` varchar(64),
+  `nonce` varchar(64),
+  `code_verifier` varchar(128),
+  `link_user_id` bigint unsigned,
+  `expires_at` datetime(3) NULL,
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE INDEX `idx_oauth_states_state_hash` (`state_hash`),
+  INDEX `idx_oauth_states_expires_at` (`expires_at`)
+);
@@ -0,0 +1,16 @@
+CREATE TABLE `api_keys` (
+  `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+  `user_id` bigint unsigned,
+  `name` varchar(100),
+  `prefix` varchar(16),
+  `key_hash` varchar(64),
+  `scopes` longtext,
+  `expires_at` datetime(3) NULL,
+  `last_used_at` datetime(3) NULL,
+  `last_used_ip` varchar(64),
+  `created_at` datetime(3) NULL,
+  PRIMARY KEY (`id`),
+  INDEX `idx_api_keys_user_id` (`user_id`),
+  UNIQUE INDEX `idx_api_keys_key_hash` (`key_hash`),
+  INDEX `idx_api_keys_expires_at` (`expires_at`)
+);
@@ -0,0 +1,45 @@
+CREATE TABLE "users" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  "deleted_at" timestamptz,
+  "email" varchar(191),
+  "password" text,
+  "email_verified_at" timestamptz,
+  PRIMARY KEY ("id"),
+  CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "user_details" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "first_name" text,
+  "last_name" text,
+  "phone" text,
+  "bio" text,
+  "avatar_url" text,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_user_details_user_id" ON "user_details" ("user_id");
+
+CREATE TABLE "user_sessions" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "jti" varchar(36),
+  "family_id" varchar(36),
+  "parent_id" bigint,
+  "rotated_at" timestamptz,
+  "label" varchar(100),
+  "user_agent" text,
+  "ip_address" varchar(64),
+  "created_at" timestamptz,
+  "expires_at" timestamptz,
+  "last_seen_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_user_sessions_user_id" ON "user_sessions" ("user_id");
+CREATE UNIQUE INDEX "idx_user_sessions_jti" ON "user_sessions" ("jti");
+CREATE INDEX "idx_user_sessions_family_id" ON "user_sessions" ("family_id");
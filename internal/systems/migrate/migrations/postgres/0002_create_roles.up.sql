@@ -0,0 +1,33 @@
+CREATE TABLE "roles" (
+  "id" bigserial NOT NULL,
+  "name" varchar(64),
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_roles_name" ON "roles" ("name");
+
+CREATE TABLE "permissions" (
+  "id" bigserial NOT NULL,
+  "name" varchar(64),
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_permissions_name" ON "permissions" ("name");
+
+CREATE TABLE "user_roles" (
+  "user_id" bigint NOT NULL,
+  "role_id" bigint NOT NULL,
+  PRIMARY KEY ("user_id", "role_id"),
+  CONSTRAINT "fk_user_roles_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id"),
+  CONSTRAINT "fk_user_roles_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id")
+);
+
+CREATE TABLE "role_permissions" (
+  "role_id" bigint NOT NULL,
+  "permission_id" bigint NOT NULL,
+  PRIMARY KEY ("role_id", "permission_id"),
+  CONSTRAINT "fk_role_permissions_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id"),
+  CONSTRAINT "fk_role_permissions_permission" FOREIGN KEY ("permission_id") REFERENCES "permissions" ("id")
+);
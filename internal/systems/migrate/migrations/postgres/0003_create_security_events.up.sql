@@ -0,0 +1,12 @@
+CREATE TABLE "security_events" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "type" varchar(64),
+  "family_id" varchar(36),
+  "ip_address" varchar(64),
+  "user_agent" text,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_security_events_user_id" ON "security_events" ("user_id");
+CREATE INDEX "idx_security_events_type" ON "security_events" ("type");
@@ -0,0 +1,11 @@
+CREATE TABLE "password_reset_tokens" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "token_hash" varchar(64),
+  "expires_at" timestamptz,
+  "used_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+CREATE UNIQUE INDEX "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
@@ -0,0 +1,11 @@
+CREATE TABLE "email_verification_tokens" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "token_hash" varchar(64),
+  "expires_at" timestamptz,
+  "used_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_email_verification_tokens_user_id" ON "email_verification_tokens" ("user_id");
+CREATE UNIQUE INDEX "idx_email_verification_tokens_token_hash" ON "email_verification_tokens" ("token_hash");
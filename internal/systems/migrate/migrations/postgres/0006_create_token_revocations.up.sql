@@ -0,0 +1,14 @@
+CREATE TABLE "revoked_tokens" (
+  "jti" varchar(36) NOT NULL,
+  "expires_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("jti")
+);
+CREATE INDEX "idx_revoked_tokens_expires_at" ON "revoked_tokens" ("expires_at");
+
+CREATE TABLE "token_revocations" (
+  "user_id" bigint NOT NULL,
+  "revoked_before" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("user_id")
+);
@@ -0,0 +1,22 @@
+CREATE TABLE "user_mfas" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "secret" varchar(64),
+  "enabled_at" timestamptz,
+  "last_used_step" bigint,
+  "created_at" timestamptz,
+  "updated_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_user_mfas_user_id" ON "user_mfas" ("user_id");
+
+CREATE TABLE "mfa_recovery_codes" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "code_hash" varchar(64),
+  "used_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_mfa_recovery_codes_user_id" ON "mfa_recovery_codes" ("user_id");
+CREATE UNIQUE INDEX "idx_mfa_recovery_codes_code_hash" ON "mfa_recovery_codes" ("code_hash");
@@ -0,0 +1,10 @@
+CREATE TABLE "login_throttles" (
+  "id" bigserial NOT NULL,
+  "throttle_key" varchar(320),
+  "failures" bigint,
+  "last_failure_at" timestamptz,
+  "locked_until" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_login_throttles_throttle_key" ON "login_throttles" ("throttle_key");
+CREATE INDEX "idx_login_throttles_last_failure_at" ON "login_throttles" ("last_failure_at");
@@ -0,0 +1,26 @@
+CREATE TABLE "user_identities" (
+  "id" bigserial NOT NULL,
+  "user_id" bigint,
+  "provider" varchar(64),
+  "subject" varchar(255),
+  "email" text,
+  "created_at" timestamptz,
+  "last_login_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE INDEX "idx_user_identities_user_id" ON "user_identities" ("user_id");
+CREATE UNIQUE INDEX "idx_user_identities_provider_subject" ON "user_identities" ("provider", "subject");
+
+CREATE TABLE "oauth_states" (
+  "id" bigserial NOT NULL,
+  "state_hash" varchar(64),
+  "provider" varchar(64),
+  "nonce" varchar(64),
+  "code_verifier" varchar(128),
+  "link_user_id" bigint,
+  "expires_at" timestamptz,
+  "created_at" timestamptz,
+  PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX "idx_oauth_states_state_hash" ON "oauth_states" ("state_hash");
+CREATE INDEX "idx_oauth_states_expires_at" ON "oauth_states" ("expires_at");
@@ -0,0 +1,42 @@
+CREATE TABLE "users" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "created_at" datetime,
+  "updated_at" datetime,
+  "deleted_at" datetime,
+  "email" varchar(191),
+  "password" text,
+  "email_verified_at" datetime,
+  CONSTRAINT "uni_users_email" UNIQUE ("email")
+);
+CREATE INDEX "idx_users_deleted_at" ON "users" ("deleted_at");
+
+CREATE TABLE "user_details" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "first_name" text,
+  "last_name" text,
+  "phone" text,
+  "bio" text,
+  "avatar_url" text,
+  "created_at" datetime,
+  "updated_at" datetime
+);
+CREATE UNIQUE INDEX "idx_user_details_user_id" ON "user_details" ("user_id");
+
+CREATE TABLE "user_sessions" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "jti" varchar(36),
+  "family_id" varchar(36),
+  "parent_id" integer,
+  "rotated_at" datetime,
+  "label" varchar(100),
+  "user_agent" text,
+  "ip_address" varchar(64),
+  "created_at" datetime,
+  "expires_at" datetime,
+  "last_seen_at" datetime
+);
+CREATE INDEX "idx_user_sessions_user_id" ON "user_sessions" ("user_id");
+CREATE UNIQUE INDEX "idx_user_sessions_jti" ON "user_sessions" ("jti");
+CREATE INDEX "idx_user_sessions_family_id" ON "user_sessions" ("family_id");
@@ -0,0 +1,31 @@
+CREATE TABLE "roles" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "name" varchar(64),
+  "created_at" datetime,
+  "updated_at" datetime
+);
+CREATE UNIQUE INDEX "idx_roles_name" ON "roles" ("name");
+
+CREATE TABLE "permissions" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "name" varchar(64),
+  "created_at" datetime,
+  "updated_at" datetime
+);
+CREATE UNIQUE INDEX "idx_permissions_name" ON "permissions" ("name");
+
+CREATE TABLE "user_roles" (
+  "user_id" integer NOT NULL,
+  "role_id" integer NOT NULL,
+  PRIMARY KEY ("user_id", "role_id"),
+  CONSTRAINT "fk_user_roles_user" FOREIGN KEY ("user_id") REFERENCES "users" ("id"),
+  CONSTRAINT "fk_user_roles_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id")
+);
+
+CREATE TABLE "role_permissions" (
+  "role_id" integer NOT NULL,
+  "permission_id" integer NOT NULL,
+  PRIMARY KEY ("role_id", "permission_id"),
+  CONSTRAINT "fk_role_permissions_role" FOREIGN KEY ("role_id") REFERENCES "roles" ("id"),
+  CONSTRAINT "fk_role_permissions_permission" FOREIGN KEY ("permission_id") REFERENCES "permissions" ("id")
+);
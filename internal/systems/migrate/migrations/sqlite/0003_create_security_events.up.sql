@@ -0,0 +1,11 @@
+CREATE TABLE "security_events" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "type" varchar(64),
+  "family_id" varchar(36),
+  "ip_address" varchar(64),
+  "user_agent" text,
+  "created_at" datetime
+);
+CREATE INDEX "idx_security_events_user_id" ON "security_events" ("user_id");
+CREATE INDEX "idx_security_events_type" ON "security_events" ("type");
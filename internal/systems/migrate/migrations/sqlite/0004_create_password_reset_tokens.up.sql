@@ -0,0 +1,10 @@
+CREATE TABLE "password_reset_tokens" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "token_hash" varchar(64),
+  "expires_at" datetime,
+  "used_at" datetime,
+  "created_at" datetime
+);
+CREATE INDEX "idx_password_reset_tokens_user_id" ON "password_reset_tokens" ("user_id");
+CREATE UNIQUE INDEX "idx_password_reset_tokens_token_hash" ON "password_reset_tokens" ("token_hash");
@@ -0,0 +1,10 @@
+CREATE TABLE "email_verification_tokens" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "token_hash" varchar(64),
+  "expires_at" datetime,
+  "used_at" datetime,
+  "created_at" datetime
+);
+CREATE INDEX "idx_email_verification_tokens_user_id" ON "email_verification_tokens" ("user_id");
+CREATE UNIQUE INDEX "idx_email_verification_tokens_token_hash" ON "email_verification_tokens" ("token_hash");
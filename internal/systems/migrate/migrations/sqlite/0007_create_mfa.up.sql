@@ -0,0 +1,20 @@
+CREATE TABLE "user_mfas" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "secret" varchar(64),
+  "enabled_at" datetime,
+  "last_used_step" integer,
+  "created_at" datetime,
+  "updated_at" datetime
+);
+CREATE UNIQUE INDEX "idx_user_mfas_user_id" ON "user_mfas" ("user_id");
+
+CREATE TABLE "mfa_recovery_codes" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "code_hash" varchar(64),
+  "used_at" datetime,
+  "created_at" datetime
+);
+CREATE INDEX "idx_mfa_recovery_codes_user_id" ON "mfa_recovery_codes" ("user_id");
+CREATE UNIQUE INDEX "idx_mfa_recovery_codes_code_hash" ON "mfa_recovery_codes" ("code_hash");
@@ -0,0 +1,9 @@
+CREATE TABLE "login_throttles" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "throttle_key" varchar(320),
+  "failures" integer,
+  "last_failure_at" datetime,
+  "locked_until" datetime
+);
+CREATE UNIQUE INDEX "idx_login_throttles_throttle_key" ON "login_throttles" ("throttle_key");
+CREATE INDEX "idx_login_throttles_last_failure_at" ON "login_throttles" ("last_failure_at");
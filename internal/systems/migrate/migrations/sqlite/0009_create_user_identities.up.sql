@@ -0,0 +1,24 @@
+CREATE TABLE "user_identities" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "provider" varchar(64),
+  "subject" varchar(255),
+  "email" text,
+  "created_at" datetime,
+  "last_login_at" datetime
+);
+CREATE INDEX "idx_user_identities_user_id" ON "user_identities" ("user_id");
+CREATE UNIQUE INDEX "idx_user_identities_provider_subject" ON "user_identities" ("provider", "subject");
+
+CREATE TABLE "oauth_states" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "state_hash" varchar(64),
+  "provider" varchar(64),
+  "nonce" varchar(64),
+  "code_verifier" varchar(128),
+  "link_user_id" integer,
+  "expires_at" datetime,
+  "created_at" datetime
+);
+CREATE UNIQUE INDEX "idx_oauth_states_state_hash" ON "oauth_states" ("state_hash");
+CREATE INDEX "idx_oauth_states_expires_at" ON "oauth_states" ("expires_at");
@@ -0,0 +1,15 @@
+CREATE TABLE "api_keys" (
+  "id" integer PRIMARY KEY AUTOINCREMENT,
+  "user_id" integer,
+  "name" varchar(100),
+  "prefix" varchar(16),
+  "key_hash" varchar(64),
+  "scopes" text,
+  "expires_at" datetime,
+  "last_used_at" datetime,
+  "last_used_ip" varchar(64),
+  "created_at" datetime
+);
+CREATE INDEX "idx_api_keys_user_id" ON "api_keys" ("user_id");
+CREATE UNIQUE INDEX "idx_api_keys_key_hash" ON "api_keys" ("key_hash");
+CREATE INDEX "idx_api_keys_expires_at" ON "api_keys" ("expires_at");
@@ -0,0 +1,192 @@
+package oidc
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MockProvider is a local OpenID Connect provider for development and tests. Nobody is asked for a password:
+// the authorization endpoint signs in the email of the "login_hint" parameter right away and redirects back.
+// Never enable it in production.
+type MockProvider struct {
+	Issuer string
+	Now    func() time.Time // Clock, replaceable in tests
+
+	keys   *signing.KeyManager
+	mu     sync.Mutex
+	grants map[string]mockGrant // Authorization code to grant
+}
+
+type mockGrant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	email         string
+	expiresAt     time.Time
+}
+
+// NewMockProvider creates a mock provider for the issuer URL it is served on, with a new Ed25519 signing key
+func NewMockProvider(issuer string) (*MockProvider, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := signing.Thumbprint(public)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := signing.NewKeyManager(&signing.Key{ID: kid, Method: jwt.SigningMethodEdDSA, Private: private, Public: public})
+	if err != nil {
+		return nil, err
+	}
+
+	return &MockProvider{
+		Issuer: strings.TrimSuffix(issuer, "/"),
+		Now:    time.Now,
+		keys:   keys,
+		grants: map[string]mockGrant{},
+	}, nil
+}
+
+func (p *MockProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/.well-known/openid-configuration"):
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                p.Issuer,
+			"authorization_endpoint":                p.Issuer + "/authorize",
+			"token_endpoint":                        p.Issuer + "/token",
+			"jwks_uri":                              p.Issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"EdDSA"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	case strings.HasSuffix(r.URL.Path, "/jwks"):
+		writeJSON(w, http.StatusOK, p.keys.JWKS())
+	case strings.HasSuffix(r.URL.Path, "/authorize"):
+		p.authorize(w, r)
+	case strings.HasSuffix(r.URL.Path, "/token"):
+		p.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (p *MockProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || redirectURI.Scheme == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	email := query.Get("login_hint")
+	if email == "" {
+		email = "mock.user@example.com"
+	}
+
+	code := rand.Text()
+	p.mu.Lock()
+	p.pruneGrants()
+	p.grants[code] = mockGrant{
+		clientID:      query.Get("client_id"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		email:         email,
+		expiresAt:     p.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	params := redirectURI.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirectURI.RawQuery = params.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// pruneGrants drops the codes that expired without being redeemed, the caller holds the lock
+func (p *MockProvider) pruneGrants() {
+	now := p.Now()
+	for code, grant := range p.grants {
+		if now.After(grant.expiresAt) {
+			delete(p.grants, code)
+		}
+	}
+}
+
+func (p *MockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	// Codes are single use
+	p.mu.Lock()
+	grant, ok := p.grants[r.PostForm.Get("code")]
+	delete(p.grants, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if !ok || p.Now().After(grant.expiresAt) ||
+		grant.clientID != r.PostForm.Get("client_id") ||
+		grant.redirectURI != r.PostForm.Get("redirect_uri") ||
+		subtle.ConstantTimeCompare([]byte(grant.codeChallenge), []byte(challenge)) != 1 {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := p.Now()
+	name, _, _ := strings.Cut(grant.email, "@")
+	idToken, _, err := p.keys.Sign(&IDTokenClaims{
+		Nonce:         grant.nonce,
+		Email:         grant.email,
+		EmailVerified: true,
+		Name:          name,
+		GivenName:     name,
+		FamilyName:    "Mock",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.Issuer,
+			Subject:   "mock-" + grant.email,
+			Audience:  jwt.ClaimStrings{grant.clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	})
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: rand.Text(),
+		TokenType:   "Bearer",
+		IDToken:     idToken,
+		ExpiresIn:   300,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
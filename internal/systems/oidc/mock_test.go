@@ -0,0 +1,207 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// newMockClient serves a mock provider and returns a client of it
+func newMockClient(t *testing.T) (*Client, *MockProvider) {
+	t.Helper()
+
+	var provider *MockProvider
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		provider.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	provider, err := NewMockProvider(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := NewClient(Config{
+		Name:        "mock",
+		Issuer:      server.URL,
+		ClientID:    "gobete",
+		RedirectURL: "http://app.example/oauth/mock/callback",
+	})
+	client.HTTPClient = server.Client()
+	return client, provider
+}
+
+// authorize follows the authorization URL like a browser would and returns the code and state
+// the provider redirected back with
+func authorize(t *testing.T, client *Client, state, nonce, codeChallenge, email string) (string, string) {
+	t.Helper()
+
+	authorizationURL, err := client.AuthCodeURL(context.Background(), state, nonce, codeChallenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	httpClient := *client.HTTPClient
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, err := httpClient.Get(authorizationURL + "&login_hint=" + url.QueryEscape(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", res.StatusCode, http.StatusFound)
+	}
+
+	location, err := res.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestMockProviderFlow(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newMockClient(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := authorize(t, client, "state-1", "nonce-1", challenge, "jane@example.com")
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+
+	tokenResponse, err := client.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := client.VerifyIDToken(ctx, tokenResponse.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "mock-jane@example.com" || claims.Email != "jane@example.com" || !claims.EmailVerified {
+		t.Errorf("claims = %+v, want the verified email jane@example.com", claims)
+	}
+
+	// Codes are single use
+	if _, err := client.Exchange(ctx, code, verifier); err == nil {
+		t.Error("Exchange accepted a code twice")
+	}
+}
+
+func TestMockProviderRejectsWrongCodeVerifier(t *testing.T) {
+	client, _ := newMockClient(t)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherVerifier, _, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, client, "state", "nonce", challenge, "jane@example.com")
+
+	if _, err := client.Exchange(context.Background(), code, otherVerifier); err == nil {
+		t.Error("Exchange accepted a code verifier that does not match the challenge")
+	}
+}
+
+func TestMockProviderRequiresPKCE(t *testing.T) {
+	client, _ := newMockClient(t)
+
+	authorizationURL, err := client.AuthCodeURL(context.Background(), "state", "nonce", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.HTTPClient.Get(authorizationURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("authorize without code challenge status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestVerifyIDTokenRejectsWrongNonce(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newMockClient(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, client, "state", "nonce-1", challenge, "jane@example.com")
+	tokenResponse, err := client.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.VerifyIDToken(ctx, tokenResponse.IDToken, "nonce-2"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestVerifyIDTokenRejectsExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	client, _ := newMockClient(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, client, "state", "nonce", challenge, "jane@example.com")
+	tokenResponse, err := client.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// ID tokens of the mock provider are valid for 5 minutes, with a minute of leeway
+	client.Now = func() time.Time { return time.Now().Add(10 * time.Minute) }
+	if _, err := client.VerifyIDToken(ctx, tokenResponse.IDToken, "nonce"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("VerifyIDToken error = %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestMockProviderRejectsExpiredCode(t *testing.T) {
+	client, provider := newMockClient(t)
+
+	verifier, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := authorize(t, client, "state", "nonce", challenge, "jane@example.com")
+
+	// Codes of the mock provider are valid for a minute
+	provider.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	if _, err := client.Exchange(context.Background(), code, verifier); err == nil {
+		t.Error("Exchange accepted an expired code")
+	}
+}
+
+func TestMockProviderPrunesUnredeemedCodes(t *testing.T) {
+	client, provider := newMockClient(t)
+
+	_, challenge, err := NewPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize(t, client, "state", "nonce", challenge, "jane@example.com")
+	authorize(t, client, "state", "nonce", challenge, "joe@example.com")
+
+	// Codes of the mock provider are valid for a minute, the next authorization drops the expired ones
+	provider.Now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+	authorize(t, client, "state", "nonce", challenge, "jane@example.com")
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if len(provider.grants) != 1 {
+		t.Errorf("%d codes kept, want only the unexpired one", len(provider.grants))
+	}
+}
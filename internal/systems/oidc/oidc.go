@@ -0,0 +1,307 @@
+// Package oidc is a minimal OpenID Connect relying party: discovery, authorization code
+// flow with PKCE and ID token verification against the provider JWKS.
+package oidc
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownProvider = errors.New("unknown oidc provider")
+	ErrInvalidIDToken  = errors.New("invalid id token")
+)
+
+// Config of a provider
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Metadata is the subset of the provider discovery document used by the client
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// TokenResponse is the response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// IDTokenClaims are the standard claims read from an ID token
+type IDTokenClaims struct {
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+	Name            string `json:"name"`
+	GivenName       string `json:"given_name"`
+	FamilyName      string `json:"family_name"`
+	jwt.RegisteredClaims
+}
+
+// Client talks to one provider. Discovery and keys are fetched on first use and cached.
+type Client struct {
+	Config     Config
+	HTTPClient *http.Client
+	Now        func() time.Time // Clock, replaceable in tests
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     map[string]signing.JWK
+}
+
+func NewClient(config Config) *Client {
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Client{
+		Config:     config,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+		Now:        time.Now,
+	}
+}
+
+// Providers are the configured providers by name
+type Providers map[string]*Client
+
+// NewProviders creates the configured providers, see config.OIDCConfig
+func NewProviders(cfg config.OIDCConfig) Providers {
+	providers := Providers{}
+	for name, provider := range cfg.Providers {
+		providers[name] = NewClient(Config{
+			Name:         name,
+			Issuer:       provider.Issuer,
+			ClientID:     provider.ClientID,
+			ClientSecret: provider.ClientSecret,
+			RedirectURL:  provider.RedirectURL,
+			Scopes:       provider.Scopes,
+		})
+	}
+	return providers
+}
+
+// Get returns a configured provider by name
+func (p Providers) Get(name string) (*Client, error) {
+	client, ok := p[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	return client, nil
+}
+
+// NewPKCE returns a random code verifier and its S256 code challenge (RFC 7636)
+func NewPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Metadata fetches the discovery document of the issuer
+func (c *Client) Metadata(ctx context.Context) (*Metadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.metadata != nil {
+		return c.metadata, nil
+	}
+
+	var metadata Metadata
+	if err := c.getJSON(ctx, strings.TrimSuffix(c.Config.Issuer, "/")+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	if metadata.Issuer != c.Config.Issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch, got %q", metadata.Issuer)
+	}
+
+	c.metadata = &metadata
+	return c.metadata, nil
+}
+
+// AuthCodeURL returns the URL of the provider login page
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", c.Config.ClientID)
+	query.Set("redirect_uri", c.Config.RedirectURL)
+	query.Set("scope", strings.Join(c.Config.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange trades the authorization code for tokens
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier string) (*TokenResponse, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.Config.RedirectURL)
+	form.Set("client_id", c.Config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+	if c.Config.ClientSecret != "" {
+		form.Set("client_secret", c.Config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var tokenResponse TokenResponse
+	if err := c.doJSON(req, &tokenResponse); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("oidc token exchange: no id_token in response")
+	}
+
+	return &tokenResponse, nil
+}
+
+// VerifyIDToken verifies the signature, issuer, audience, expiry and nonce of an ID token
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDTokenClaims, error) {
+	metadata, err := c.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return c.publicKey(ctx, metadata, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(time.Minute),
+		jwt.WithTimeFunc(c.Now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	// With several audiences the token must be issued to us
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != c.Config.ClientID {
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIDToken)
+	}
+
+	return claims, nil
+}
+
+// publicKey returns the provider key by ID, the key set is fetched again once for unknown IDs (key rotation)
+func (c *Client) publicKey(ctx context.Context, metadata *Metadata, kid string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key.PublicKey()
+	}
+
+	var set signing.JWKSet
+	if err := c.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	c.keys = map[string]signing.JWK{}
+	for _, key := range set.Keys {
+		if key.Use == "" || key.Use == "sig" {
+			c.keys[key.Kid] = key
+		}
+	}
+
+	if key, ok := c.lookupKey(kid); ok {
+		return key.PublicKey()
+	}
+	return nil, fmt.Errorf("oidc jwks: unknown key id %q", kid)
+}
+
+// lookupKey finds a cached key, a token without key ID is accepted only if the set has a single key
+func (c *Client) lookupKey(kid string) (signing.JWK, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, ok := c.keys[kid]
+	return key, ok
+}
+
+func (c *Client) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return c.doJSON(req, v)
+}
+
+func (c *Client) doJSON(req *http.Request, v any) error {
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
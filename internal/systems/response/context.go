@@ -0,0 +1,27 @@
+package response
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"context"
+	"errors"
+)
+
+// Error codes of requests whose work ended with its context
+const (
+	CodeRequestTimeout  = "request_timeout"  // 504, the deadline of the request passed
+	CodeRequestCanceled = "request_canceled" // 503, work the request waited for was canceled, e.g. an upstream call
+)
+
+// IsContextError reports whether err is the end of a context, a deadline or a cancellation
+func IsContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// Helper for requests whose context ended: 504 when the deadline passed, 503 when it was canceled
+func SendContextError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return SendErrorResponse(c, fiber.StatusGatewayTimeout, CodeRequestTimeout, "The request took too long to complete. Please try again.")
+	}
+	return SendErrorResponse(c, fiber.StatusServiceUnavailable, CodeRequestCanceled, "The request was canceled before it completed. Please try again.")
+}
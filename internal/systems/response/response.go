@@ -7,10 +7,34 @@ import (
 
 // Error response
 type ErrorResponse struct {
-	Code    string `json:"code"`
-	Success bool   `json:"success"`
-	Message string `json:"message"`
-	Details any    `json:"details,omitempty"`
+	Code      string `json:"code"`
+	Success   bool   `json:"success"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"request_id,omitempty"` // Same as the X-Request-ID header, for support to trace the call
+}
+
+// Pagination metadata for list responses
+type Pagination struct {
+	Page       int   `json:"page"`
+	PerPage    int   `json:"per_page"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// NewPagination computes the total number of pages for the given page, page size and total item count
+func NewPagination(page, perPage int, total int64) Pagination {
+	totalPages := 0
+	if perPage > 0 {
+		totalPages = int((total + int64(perPage) - 1) / int64(perPage))
+	}
+
+	return Pagination{
+		Page:       page,
+		PerPage:    perPage,
+		Total:      total,
+		TotalPages: totalPages,
+	}
 }
 
 // Helper for success response
@@ -22,6 +46,16 @@ func SendSuccessResponse(c *fiber.Ctx, message string, data any) error {
 	})
 }
 
+// Helper for paginated success response
+func SendPaginatedResponse(c *fiber.Ctx, message string, data any, pagination Pagination) error {
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"success":    true,
+		"message":    message,
+		"data":       data,
+		"pagination": pagination,
+	})
+}
+
 // Helper for error response
 func SendErrorResponse(c *fiber.Ctx, status int, code string, message ...any) error {
 	var msg string
@@ -53,10 +87,11 @@ func SendErrorResponse(c *fiber.Ctx, status int, code string, message ...any) er
 	}
 
 	resp := ErrorResponse{
-		Code:    code,
-		Success: false,
-		Message: msg,
-		Details: detail,
+		Code:      code,
+		Success:   false,
+		Message:   msg,
+		Details:   detail,
+		RequestID: c.GetRespHeader(fiber.HeaderXRequestID),
 	}
 
 	return c.Status(status).JSON(resp)
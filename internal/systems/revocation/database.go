@@ -0,0 +1,80 @@
+package revocation
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"context"
+	"time"
+)
+
+// RevokedToken is a single revoked token, kept until it expires
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:36"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// TokenRevocation is the revocation watermark of a user, tokens issued before RevokedBefore are invalid
+type TokenRevocation struct {
+	UserID        uint `gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time
+	UpdatedAt     time.Time
+}
+
+// DatabaseStore keeps revoked tokens in the database, shared by every instance
+type DatabaseStore struct {
+	db *gorm.DB
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	return s.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func (s *DatabaseStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	// A replica lagging behind must not accept a token revoked a moment ago
+	var count int64
+	err := s.db.WithContext(db.Primary(ctx)).Model(&RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+func (s *DatabaseStore) RevokeUserTokens(ctx context.Context, userID uint, before time.Time) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var watermark TokenRevocation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", userID).First(&watermark).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Create(&TokenRevocation{UserID: userID, RevokedBefore: before}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// The watermark only moves forward
+		if !before.After(watermark.RevokedBefore) {
+			return nil
+		}
+		return tx.Model(&watermark).Update("revoked_before", before).Error
+	})
+}
+
+func (s *DatabaseStore) UserTokensRevokedBefore(ctx context.Context, userID uint) (time.Time, error) {
+	var watermarks []TokenRevocation
+	if err := s.db.WithContext(db.Primary(ctx)).Where("user_id = ?", userID).Limit(1).Find(&watermarks).Error; err != nil {
+		return time.Time{}, err
+	}
+	if len(watermarks) == 0 {
+		return time.Time{}, nil
+	}
+	return watermarks[0].RevokedBefore, nil
+}
+
+func (s *DatabaseStore) Cleanup(ctx context.Context, now time.Time) error {
+	return s.db.WithContext(ctx).Where("expires_at < ?", now).Delete(&RevokedToken{}).Error
+}
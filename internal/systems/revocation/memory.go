@@ -0,0 +1,62 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps revoked tokens in memory, for a single instance and local development
+type MemoryStore struct {
+	mu         sync.RWMutex
+	tokens     map[string]time.Time // JTI to expiry
+	watermarks map[uint]time.Time   // User ID to revocation watermark
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tokens:     map[string]time.Time{},
+		watermarks: map[uint]time.Time{},
+	}
+}
+
+func (s *MemoryStore) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[jti] = expiresAt
+	return nil
+}
+
+func (s *MemoryStore) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.tokens[jti]
+	return ok, nil
+}
+
+func (s *MemoryStore) RevokeUserTokens(ctx context.Context, userID uint, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The watermark only moves forward
+	if before.After(s.watermarks[userID]) {
+		s.watermarks[userID] = before
+	}
+	return nil
+}
+
+func (s *MemoryStore) UserTokensRevokedBefore(ctx context.Context, userID uint) (time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.watermarks[userID], nil
+}
+
+func (s *MemoryStore) Cleanup(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for jti, expiresAt := range s.tokens {
+		if expiresAt.Before(now) {
+			delete(s.tokens, jti)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package revocation
+
+import (
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+	"gorm.io/gorm"
+
+	"context"
+	"fmt"
+	"time"
+)
+
+// Store keeps revoked tokens. A token is revoked either by its JTI, or because it was issued
+// before the revocation watermark of its user ("every token issued before T is invalid").
+type Store interface {
+	// RevokeToken revokes a single token until it expires
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	// IsTokenRevoked reports whether the token with the given JTI was revoked
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	// RevokeUserTokens revokes every token of the user issued before the given time
+	RevokeUserTokens(ctx context.Context, userID uint, before time.Time) error
+	// UserTokensRevokedBefore returns the revocation watermark of the user, zero if there is none
+	UserTokensRevokedBefore(ctx context.Context, userID uint) (time.Time, error)
+	// Cleanup removes revoked tokens that expired before now anyway
+	Cleanup(ctx context.Context, now time.Time) error
+}
+
+// NewStore creates the store implementation of REVOCATION_STORE.
+// Supported stores are "database" and "memory" (default). The memory store is not
+// shared between instances and is lost on restart.
+func NewStore(cfg config.RevocationConfig, db *gorm.DB) (Store, error) {
+	switch store := cfg.Store; store {
+	case "database":
+		return NewDatabaseStore(db), nil
+	case "", "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknown REVOCATION_STORE: %s", store)
+	}
+}
+
+// IsRevoked reports whether a token was revoked by its JTI or by the watermark of its user
+func IsRevoked(ctx context.Context, store Store, claims *token.Claims) (bool, error) {
+	revoked, err := store.IsTokenRevoked(ctx, claims.ID)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	before, err := store.UserTokensRevokedBefore(ctx, claims.UserID)
+	if err != nil || before.IsZero() {
+		return false, err
+	}
+
+	return claims.IssuedAt == nil || claims.IssuedAt.Time.Before(before), nil
+}
+
+// RevokeClaims revokes a single token until it expires
+func RevokeClaims(ctx context.Context, store Store, claims *token.Claims) error {
+	if claims.ExpiresAt == nil {
+		return nil // Not issued by the token service, it is refused anyway
+	}
+	return store.RevokeToken(ctx, claims.ID, claims.ExpiresAt.Time)
+}
+
+// RevokeUser revokes every token issued to the user until now, the time of the application clock.
+// Token timestamps have second precision, so the watermark is rounded up to the next second: a token
+// issued earlier in the same second is revoked, as is one issued later in that second.
+func RevokeUser(ctx context.Context, store Store, userID uint, now time.Time) error {
+	return store.RevokeUserTokens(ctx, userID, now.Truncate(time.Second).Add(time.Second))
+}
@@ -0,0 +1,111 @@
+package revocation
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/db"
+	"github.com/sonyarianto/gobete/internal/systems/token"
+
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// stores returns a memory store and a database store on a SQLite file
+func stores(t *testing.T) map[string]Store {
+	t.Helper()
+
+	database, err := db.Connect(config.DBConfig{Driver: db.SQLite, Name: filepath.Join(t.TempDir(), "gobete.db"), ConnectRetryDelaySeconds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sqlDB, _ := database.DB()
+		sqlDB.Close()
+	})
+	if err := database.AutoMigrate(&RevokedToken{}, &TokenRevocation{}); err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Store{"memory": NewMemoryStore(), "database": NewDatabaseStore(database)}
+}
+
+// claims of a token of user 1, issued at the second of issuedAt like real tokens
+func claims(jti string, issuedAt time.Time) *token.Claims {
+	return &token.Claims{
+		UserID: 1,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(issuedAt.Add(time.Hour)),
+		},
+	}
+}
+
+func TestRevokeUser(t *testing.T) {
+	revokedAt := time.Date(2026, 3, 1, 12, 0, 0, 700_000_000, time.UTC)
+
+	tests := []struct {
+		name        string
+		issuedAt    time.Time
+		wantRevoked bool
+	}{
+		{"issued a minute before", revokedAt.Add(-time.Minute), true},
+		{"issued earlier in the same second", revokedAt.Add(-500 * time.Millisecond), true},
+		{"issued later in the same second", revokedAt.Add(200 * time.Millisecond), true},
+		{"issued in the next second", revokedAt.Add(time.Second), false},
+	}
+	for name, store := range stores(t) {
+		if err := RevokeUser(t.Context(), store, 1, revokedAt); err != nil {
+			t.Fatal(err)
+		}
+		for _, tt := range tests {
+			revoked, err := IsRevoked(t.Context(), store, claims("jti", tt.issuedAt))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if revoked != tt.wantRevoked {
+				t.Errorf("%s store, token %s: revoked = %v, want %v", name, tt.name, revoked, tt.wantRevoked)
+			}
+		}
+
+		// The watermark only moves forward
+		if err := RevokeUser(t.Context(), store, 1, revokedAt.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := IsRevoked(t.Context(), store, claims("jti", revokedAt)); err != nil || !revoked {
+			t.Errorf("%s store: token revoked before an earlier watermark = %v, %v, want revoked", name, revoked, err)
+		}
+
+		// Other users keep their tokens
+		other := claims("jti", revokedAt.Add(-time.Minute))
+		other.UserID = 2
+		if revoked, err := IsRevoked(t.Context(), store, other); err != nil || revoked {
+			t.Errorf("%s store: token of another user = %v, %v, want not revoked", name, revoked, err)
+		}
+	}
+}
+
+func TestRevokeClaims(t *testing.T) {
+	issuedAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, store := range stores(t) {
+		if err := RevokeClaims(t.Context(), store, claims("revoked", issuedAt)); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := IsRevoked(t.Context(), store, claims("revoked", issuedAt)); err != nil || !revoked {
+			t.Errorf("%s store: revoked token = %v, %v, want revoked", name, revoked, err)
+		}
+		if revoked, err := IsRevoked(t.Context(), store, claims("other", issuedAt)); err != nil || revoked {
+			t.Errorf("%s store: other token = %v, %v, want not revoked", name, revoked, err)
+		}
+
+		// Expired tokens are refused anyway, they leave the store
+		if err := store.Cleanup(t.Context(), issuedAt.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if revoked, err := store.IsTokenRevoked(t.Context(), "revoked"); err != nil || revoked {
+			t.Errorf("%s store: expired token after cleanup = %v, %v, want removed", name, revoked, err)
+		}
+	}
+}
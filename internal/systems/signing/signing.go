@@ -0,0 +1,230 @@
+package signing
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Key is a JWT signing or verification key
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+	// Signing key: []byte for HMAC, crypto.Signer for asymmetric methods. Nil for verification-only keys.
+	Private any
+	// Verification key: []byte for HMAC, crypto.PublicKey for asymmetric methods
+	Public any
+}
+
+// KeyManager signs tokens with the active key and verifies tokens with any of the known keys,
+// so old keys keep working during a key rotation.
+type KeyManager struct {
+	signingKey       *Key
+	verificationKeys map[string]*Key
+}
+
+// NewKeyManager creates a key manager that signs with signingKey and also accepts the verification keys
+func NewKeyManager(signingKey *Key, verificationKeys ...*Key) (*KeyManager, error) {
+	if signingKey == nil || signingKey.Private == nil {
+		return nil, errors.New("signing key is required")
+	}
+
+	manager := &KeyManager{
+		signingKey:       signingKey,
+		verificationKeys: map[string]*Key{signingKey.ID: signingKey},
+	}
+	for _, key := range verificationKeys {
+		if _, exists := manager.verificationKeys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		manager.verificationKeys[key.ID] = key
+	}
+
+	return manager, nil
+}
+
+// NewKeyManagerFromConfig creates the key manager of the JWT configuration:
+//
+//   - JWT_ALGORITHM: HS256 (default), RS256, ES256 or EdDSA
+//   - JWT_SECRET: the shared secret, for HS256
+//   - JWT_PRIVATE_KEY_FILE: PEM file with the private signing key, for RS256, ES256 and EdDSA
+//   - JWT_KEY_ID: kid of the signing key, defaults to the RFC 7638 thumbprint (or "default" for HS256)
+//   - JWT_VERIFICATION_KEY_FILES: comma separated files with previous keys that are still accepted,
+//     each entry may be prefixed with its kid as "kid=path". The algorithm of each key follows from
+//     the file: RSA, P-256 and Ed25519 PEM keys, or a previous HS256 secret, which requires a kid.
+func NewKeyManagerFromConfig(cfg config.JWTConfig) (*KeyManager, error) {
+	algorithm := cfg.Algorithm
+	if algorithm == "" {
+		algorithm = jwt.SigningMethodHS256.Alg()
+	}
+	method := jwt.GetSigningMethod(algorithm)
+
+	var signingKey *Key
+	switch method {
+	case jwt.SigningMethodHS256:
+		if cfg.Secret == "" {
+			return nil, errors.New("JWT_SECRET is required for HS256")
+		}
+		kid := cfg.KeyID
+		if kid == "" {
+			kid = "default"
+		}
+		signingKey = &Key{ID: kid, Method: method, Private: []byte(cfg.Secret), Public: []byte(cfg.Secret)}
+	case jwt.SigningMethodRS256, jwt.SigningMethodES256, jwt.SigningMethodEdDSA:
+		path := cfg.PrivateKeyFile
+		if path == "" {
+			return nil, fmt.Errorf("JWT_PRIVATE_KEY_FILE is required for %s", algorithm)
+		}
+		key, err := loadKeyFile(cfg.KeyID, path)
+		if err != nil {
+			return nil, err
+		}
+		if key.Method != method {
+			return nil, fmt.Errorf("%s holds a %s key, JWT_ALGORITHM is %s", path, key.Method.Alg(), algorithm)
+		}
+		if key.Private == nil {
+			return nil, fmt.Errorf("%s does not contain a private key", path)
+		}
+		signingKey = key
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q", algorithm)
+	}
+
+	var verificationKeys []*Key
+	for _, entry := range cfg.VerificationKeyFiles {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		kid, path, found := strings.Cut(entry, "=")
+		if !found {
+			kid, path = "", entry
+		}
+		key, err := loadKeyFile(kid, path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys = append(verificationKeys, key)
+	}
+
+	return NewKeyManager(signingKey, verificationKeys...)
+}
+
+// loadKeyFile reads a PEM private or public key, or an HS256 secret when the file is not PEM, and
+// detects the signing method from it. The kid defaults to the key thumbprint, secrets require one.
+func loadKeyFile(kid, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &Key{ID: kid}
+	if block, _ := pem.Decode(data); block == nil {
+		secret := bytes.TrimSpace(data)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("%s: empty HS256 secret", path)
+		}
+		if kid == "" {
+			return nil, fmt.Errorf("%s: an HS256 secret requires its kid, as kid=path", path)
+		}
+		key.Method, key.Private, key.Public = jwt.SigningMethodHS256, secret, secret
+		return key, nil
+	}
+
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, private, &private.PublicKey
+	} else if public, err := jwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+		key.Method, key.Public = jwt.SigningMethodRS256, public
+	} else if private, err := jwt.ParseECPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.Private, key.Public = jwt.SigningMethodES256, private, &private.PublicKey
+	} else if public, err := jwt.ParseECPublicKeyFromPEM(data); err == nil {
+		key.Method, key.Public = jwt.SigningMethodES256, public
+	} else if private, err := jwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+		key.Method, key.Private, key.Public = jwt.SigningMethodEdDSA, private, private.(ed25519.PrivateKey).Public()
+	} else if public, err := jwt.ParseEdPublicKeyFromPEM(data); err == nil {
+		key.Method, key.Public = jwt.SigningMethodEdDSA, public
+	} else {
+		return nil, fmt.Errorf("%s: not a PEM encoded RSA, EC or Ed25519 key", path)
+	}
+
+	if public, ok := key.Public.(*ecdsa.PublicKey); ok && public.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%s: ES256 requires a P-256 key", path)
+	}
+
+	if key.ID == "" {
+		key.ID, err = Thumbprint(key.Public.(crypto.PublicKey))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Sign signs the claims with the active signing key, the key ID is set in the "kid" header
+func (m *KeyManager) Sign(claims jwt.Claims) (string, *jwt.Token, error) {
+	token := jwt.NewWithClaims(m.signingKey.Method, claims)
+	token.Header["kid"] = m.signingKey.ID
+
+	signedString, err := token.SignedString(m.signingKey.Private)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signedString, token, nil
+}
+
+// Keyfunc returns the verification key for a token, selected by its "kid" header.
+// Tokens without kid, issued before key IDs were introduced, are verified with the signing key.
+func (m *KeyManager) Keyfunc(token *jwt.Token) (any, error) {
+	key := m.signingKey
+	if kid, ok := token.Header["kid"].(string); ok {
+		if key, ok = m.verificationKeys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+
+	return key.Public, nil
+}
+
+// Parse parses and verifies a token signed by one of the known keys, claims are decoded into the given claims
+func (m *KeyManager) Parse(tokenString string, claims jwt.Claims, options ...jwt.ParserOption) (*jwt.Token, error) {
+	options = append(options, jwt.WithValidMethods(m.validMethods()))
+	return jwt.ParseWithClaims(tokenString, claims, m.Keyfunc, options...)
+}
+
+func (m *KeyManager) validMethods() []string {
+	methods := []string{}
+	for _, key := range m.verificationKeys {
+		if alg := key.Method.Alg(); !slices.Contains(methods, alg) {
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// isAsymmetric reports whether the key can be published, HMAC secrets must never be
+func isAsymmetric(key *Key) bool {
+	switch key.Public.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,250 @@
+package signing
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePrivateKey stores the key as a PKCS #8 PEM file and returns its path
+func writePrivateKey(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// writePublicKey stores the key as a PKIX PEM file and returns its path
+func writePublicKey(t *testing.T, key crypto.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+}
+
+func writeFile(t *testing.T, data []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func sign(t *testing.T, keys *KeyManager) string {
+	t.Helper()
+
+	signed, _, err := keys.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestRotationKeepsAcceptingPreviousKeys(t *testing.T) {
+	_, oldEdKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newRSAKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens signed before the rotation, with an HS256 secret and with an Ed25519 key
+	oldHMAC, err := NewKeyManagerFromConfig(config.JWTConfig{Algorithm: "HS256", Secret: "old-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldEd, err := NewKeyManagerFromConfig(config.JWTConfig{Algorithm: "EdDSA", PrivateKeyFile: writePrivateKey(t, oldEdKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeyManagerFromConfig(config.JWTConfig{
+		Algorithm:      "RS256",
+		PrivateKeyFile: writePrivateKey(t, newRSAKey),
+		VerificationKeyFiles: []string{
+			"default=" + writeFile(t, []byte("old-secret\n")),
+			writePublicKey(t, oldEdKey.Public()),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, signed := range map[string]string{
+		"RS256 signing key":     sign(t, keys),
+		"HS256 previous secret": sign(t, oldHMAC),
+		"EdDSA previous key":    sign(t, oldEd),
+	} {
+		if _, err := keys.Parse(signed, &jwt.RegisteredClaims{}); err != nil {
+			t.Errorf("%s: Parse: %v", name, err)
+		}
+	}
+
+	// Each kid only accepts its own algorithm and key
+	unknown, err := NewKeyManagerFromConfig(config.JWTConfig{Algorithm: "HS256", Secret: "other-secret", KeyID: "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := NewKeyManagerFromConfig(config.JWTConfig{Algorithm: "HS256", Secret: "forged-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, signed := range map[string]string{
+		"unknown kid":  sign(t, unknown),
+		"wrong secret": sign(t, forged),
+	} {
+		if _, err := keys.Parse(signed, &jwt.RegisteredClaims{}); err == nil {
+			t.Errorf("%s: Parse accepted the token", name)
+		}
+	}
+}
+
+func TestVerificationKeysWithHS256Signing(t *testing.T) {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeyManagerFromConfig(config.JWTConfig{
+		Algorithm:            "HS256",
+		Secret:               "secret",
+		VerificationKeyFiles: []string{writePublicKey(t, edKey.Public())},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := keys.Parse(sign(t, keys), &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("Parse: %v", err)
+	}
+}
+
+func TestNewKeyManagerFromConfigErrors(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]config.JWTConfig{
+		"algorithm does not match the key": {Algorithm: "ES256", PrivateKeyFile: writePrivateKey(t, rsaKey)},
+		"public signing key":               {Algorithm: "EdDSA", PrivateKeyFile: writePublicKey(t, edKey.Public())},
+		"ES256 with a P-384 key":           {Algorithm: "ES256", PrivateKeyFile: writePrivateKey(t, p384Key)},
+		"secret without kid":               {Algorithm: "HS256", Secret: "secret", VerificationKeyFiles: []string{writeFile(t, []byte("old"))}},
+		"broken PEM file":                  {Algorithm: "HS256", Secret: "secret", VerificationKeyFiles: []string{"old=" + writeFile(t, []byte("-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"))}},
+		"duplicate kid":                    {Algorithm: "HS256", Secret: "secret", VerificationKeyFiles: []string{"default=" + writeFile(t, []byte("old"))}},
+		"missing file":                     {Algorithm: "HS256", Secret: "secret", VerificationKeyFiles: []string{filepath.Join(t.TempDir(), "missing")}},
+	}
+	for name, cfg := range tests {
+		if _, err := NewKeyManagerFromConfig(cfg); err == nil {
+			t.Errorf("%s: NewKeyManagerFromConfig succeeded, want an error", name)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeyManagerFromConfig(config.JWTConfig{
+		Algorithm:      "EdDSA",
+		KeyID:          "current",
+		PrivateKeyFile: writePrivateKey(t, edKey),
+		VerificationKeyFiles: []string{
+			"previous=" + writePublicKey(t, &rsaKey.PublicKey),
+			"secret=" + writeFile(t, []byte("old-secret")),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// HMAC secrets are never published, the signing key comes first
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2: %+v", len(set.Keys), set.Keys)
+	}
+	if got := set.Keys[0]; got.Kid != "current" || got.Kty != "OKP" || got.Crv != "Ed25519" || got.Alg != "EdDSA" || got.Use != "sig" {
+		t.Errorf("first key = %+v, want the Ed25519 signing key", got)
+	}
+	if got := set.Keys[1]; got.Kid != "previous" || got.Kty != "RSA" || got.Alg != "RS256" {
+		t.Errorf("second key = %+v, want the previous RSA key", got)
+	}
+
+	// Published keys decode back to the loaded keys
+	for i, public := range []crypto.PublicKey{edKey.Public(), &rsaKey.PublicKey} {
+		decoded, err := set.Keys[i].PublicKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !decoded.(interface{ Equal(crypto.PublicKey) bool }).Equal(public) {
+			t.Errorf("key %s does not decode to the loaded key", set.Keys[i].Kid)
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 8037, appendix A.3
+	x, err := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Thumbprint(ed25519.PublicKey(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Errorf("Thumbprint = %s, want %s", got, want)
+	}
+
+	// The default kid of a key file is its thumbprint
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := NewKeyManagerFromConfig(config.JWTConfig{Algorithm: "EdDSA", PrivateKeyFile: writePrivateKey(t, edKey)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Thumbprint(edKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := keys.JWKS().Keys[0].Kid; kid != want {
+		t.Errorf("default kid = %s, want the thumbprint %s", kid, want)
+	}
+}
@@ -0,0 +1,134 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Token types, stored in the "typ" claim so one kind of token can never be used as another
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	TypeMFA     = "mfa"     // Challenge between the password and the second factor of a login
+	TypeAPIKey  = "api_key" // Principal authenticated with an API key, never issued as a JWT
+)
+
+var ErrWrongTokenType = errors.New("wrong token type")
+
+// Claims are the registered claims plus the gobete specific ones
+type Claims struct {
+	UserID        uint     `json:"user_id"`
+	Email         string   `json:"email"`
+	Type          string   `json:"typ"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Service issues and verifies tokens
+type Service struct {
+	Keys            *signing.KeyManager
+	Issuer          string
+	Audience        []string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	MFATokenTTL     time.Duration
+	Leeway          time.Duration    // Allowed clock skew when validating exp, nbf and iat
+	Now             func() time.Time // Clock, replaceable in tests
+}
+
+// NewService creates the token service of the JWT configuration, signing with the given keys
+func NewService(keys *signing.KeyManager, cfg config.JWTConfig) *Service {
+	return &Service{
+		Keys:            keys,
+		Issuer:          cfg.Issuer,
+		Audience:        cfg.Audience,
+		AccessTokenTTL:  time.Duration(cfg.AccessTokenExpireMinutes) * time.Minute,
+		RefreshTokenTTL: time.Duration(cfg.RefreshTokenExpireDays) * 24 * time.Hour,
+		MFATokenTTL:     time.Duration(cfg.MFATokenExpireMinutes) * time.Minute,
+		Leeway:          time.Duration(cfg.LeewaySeconds) * time.Second,
+		Now:             time.Now,
+	}
+}
+
+// Issue signs a token of the given type. Registered claims (iss, sub, aud, iat, nbf, exp, jti) are set by the service.
+func (s *Service) Issue(tokenType string, claims Claims, ttl time.Duration) (string, *Claims, error) {
+	now := s.Now()
+
+	claims.Type = tokenType
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    s.Issuer,
+		Subject:   strconv.FormatUint(uint64(claims.UserID), 10),
+		Audience:  s.Audience,
+		IssuedAt:  jwt.NewNumericDate(now),
+		NotBefore: jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		ID:        uuid.NewString(),
+	}
+
+	signedString, _, err := s.Keys.Sign(&claims)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signedString, &claims, nil
+}
+
+// IssueAccessToken signs a short-lived access token
+func (s *Service) IssueAccessToken(claims Claims) (string, *Claims, error) {
+	return s.Issue(TypeAccess, claims, s.AccessTokenTTL)
+}
+
+// IssueRefreshToken signs a long-lived refresh token, only the user ID and email are kept
+func (s *Service) IssueRefreshToken(claims Claims) (string, *Claims, error) {
+	return s.Issue(TypeRefresh, Claims{UserID: claims.UserID, Email: claims.Email}, s.RefreshTokenTTL)
+}
+
+// IssueMFAToken signs a short-lived MFA challenge token, only the user ID and email are kept
+func (s *Service) IssueMFAToken(claims Claims) (string, *Claims, error) {
+	return s.Issue(TypeMFA, Claims{UserID: claims.UserID, Email: claims.Email}, s.MFATokenTTL)
+}
+
+// Parse verifies the signature, issuer, audience and time based claims of a token, and that it has the expected type
+func (s *Service) Parse(tokenString string, tokenType string) (*Claims, error) {
+	claims := &Claims{}
+	_, err := s.Keys.Parse(tokenString, claims,
+		jwt.WithIssuer(s.Issuer),
+		jwt.WithAudience(s.Audience...),
+		jwt.WithLeeway(s.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(s.Now),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Type != tokenType {
+		return nil, ErrWrongTokenType
+	}
+
+	return claims, nil
+}
+
+// ParseAccessToken verifies an access token
+func (s *Service) ParseAccessToken(tokenString string) (*Claims, error) {
+	return s.Parse(tokenString, TypeAccess)
+}
+
+// ParseRefreshToken verifies a refresh token
+func (s *Service) ParseRefreshToken(tokenString string) (*Claims, error) {
+	return s.Parse(tokenString, TypeRefresh)
+}
+
+// ParseMFAToken verifies an MFA challenge token
+func (s *Service) ParseMFAToken(tokenString string) (*Claims, error) {
+	return s.Parse(tokenString, TypeMFA)
+}
@@ -0,0 +1,176 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/signing"
+
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestService returns a token service of the default configuration and its clock
+func newTestService(t *testing.T) (*Service, *time.Time) {
+	t.Helper()
+
+	cfg := config.Default().JWT
+	cfg.Secret = "test-secret"
+	keys, err := signing.NewKeyManagerFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewService(keys, cfg)
+	s.Now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestIssueAndParseAccessToken(t *testing.T) {
+	s, now := newTestService(t)
+
+	accessToken, issued, err := s.IssueAccessToken(Claims{UserID: 42, Email: "jane@example.com", Roles: []string{"admin"}, Permissions: []string{"users:read"}, EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := s.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.UserID != 42 || claims.Email != "jane@example.com" || !claims.EmailVerified || claims.Type != TypeAccess {
+		t.Errorf("claims = %+v, want user 42 jane@example.com verified access token", claims)
+	}
+	if !slices.Equal(claims.Roles, []string{"admin"}) || !slices.Equal(claims.Permissions, []string{"users:read"}) {
+		t.Errorf("roles and permissions = %v %v, want [admin] [users:read]", claims.Roles, claims.Permissions)
+	}
+	if claims.Subject != "42" || claims.Issuer != s.Issuer || !slices.Equal(claims.Audience, s.Audience) {
+		t.Errorf("sub, iss, aud = %q %q %v, want \"42\" %q %v", claims.Subject, claims.Issuer, claims.Audience, s.Issuer, s.Audience)
+	}
+	if !claims.IssuedAt.Time.Equal(*now) || !claims.ExpiresAt.Time.Equal(now.Add(s.AccessTokenTTL)) {
+		t.Errorf("iat, exp = %v %v, want %v %v", claims.IssuedAt, claims.ExpiresAt, *now, now.Add(s.AccessTokenTTL))
+	}
+	if claims.ID == "" || claims.ID != issued.ID {
+		t.Errorf("jti = %q, want the issued %q", claims.ID, issued.ID)
+	}
+
+	_, other, err := s.IssueAccessToken(Claims{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == issued.ID {
+		t.Errorf("two tokens share the jti %q", other.ID)
+	}
+}
+
+func TestRefreshAndMFATokensOnlyKeepTheUser(t *testing.T) {
+	s, _ := newTestService(t)
+	full := Claims{UserID: 42, Email: "jane@example.com", Roles: []string{"admin"}, Permissions: []string{"users:read"}, EmailVerified: true}
+
+	for _, tt := range []struct {
+		tokenType string
+		issue     func(Claims) (string, *Claims, error)
+		parse     func(string) (*Claims, error)
+	}{
+		{TypeRefresh, s.IssueRefreshToken, s.ParseRefreshToken},
+		{TypeMFA, s.IssueMFAToken, s.ParseMFAToken},
+	} {
+		tokenString, _, err := tt.issue(full)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := tt.parse(tokenString)
+		if err != nil {
+			t.Fatalf("%s token: %v", tt.tokenType, err)
+		}
+		if claims.UserID != 42 || claims.Email != "jane@example.com" || claims.Type != tt.tokenType {
+			t.Errorf("%s token claims = %+v, want user 42 jane@example.com", tt.tokenType, claims)
+		}
+		if claims.Roles != nil || claims.Permissions != nil || claims.EmailVerified {
+			t.Errorf("%s token carries roles %v, permissions %v, verified %v, want none", tt.tokenType, claims.Roles, claims.Permissions, claims.EmailVerified)
+		}
+	}
+}
+
+func TestParseRefusesOtherTokenTypes(t *testing.T) {
+	s, _ := newTestService(t)
+	accessToken, _, _ := s.IssueAccessToken(Claims{UserID: 42})
+	refreshToken, _, _ := s.IssueRefreshToken(Claims{UserID: 42})
+	mfaToken, _, _ := s.IssueMFAToken(Claims{UserID: 42})
+
+	tests := []struct {
+		name  string
+		token string
+		parse func(string) (*Claims, error)
+	}{
+		{"refresh token as access token", refreshToken, s.ParseAccessToken},
+		{"MFA token as access token", mfaToken, s.ParseAccessToken},
+		{"access token as refresh token", accessToken, s.ParseRefreshToken},
+		{"MFA token as refresh token", mfaToken, s.ParseRefreshToken},
+		{"access token as MFA token", accessToken, s.ParseMFAToken},
+	}
+	for _, tt := range tests {
+		if _, err := tt.parse(tt.token); !errors.Is(err, ErrWrongTokenType) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrWrongTokenType)
+		}
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	s, now := newTestService(t)
+	accessToken, _, err := s.IssueAccessToken(Claims{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuedAt := *now
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		wantErr error
+	}{
+		{"before expiry", issuedAt.Add(s.AccessTokenTTL - time.Second), nil},
+		{"expired within the leeway", issuedAt.Add(s.AccessTokenTTL + s.Leeway - time.Second), nil},
+		{"expired past the leeway", issuedAt.Add(s.AccessTokenTTL + s.Leeway + time.Second), jwt.ErrTokenExpired},
+		{"issued in the future past the leeway", issuedAt.Add(-s.Leeway - time.Second), jwt.ErrTokenUsedBeforeIssued},
+	}
+	for _, tt := range tests {
+		*now = tt.at
+		if _, err := s.ParseAccessToken(accessToken); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRefusesOtherIssuerAudienceAndKey(t *testing.T) {
+	s, _ := newTestService(t)
+	accessToken, _, err := s.IssueAccessToken(Claims{UserID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Default().JWT
+	cfg.Secret = "other-secret"
+	otherKeys, err := signing.NewKeyManagerFromConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*Service)
+		wantErr error
+	}{
+		{"other issuer", func(s *Service) { s.Issuer = "someone-else" }, jwt.ErrTokenInvalidIssuer},
+		{"other audience", func(s *Service) { s.Audience = []string{"other-api"} }, jwt.ErrTokenInvalidAudience},
+		{"other signing key", func(s *Service) { s.Keys = otherKeys }, jwt.ErrTokenSignatureInvalid},
+	}
+	for _, tt := range tests {
+		verifier := *s
+		tt.change(&verifier)
+		if _, err := verifier.ParseAccessToken(accessToken); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
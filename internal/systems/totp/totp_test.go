@@ -0,0 +1,118 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Base32 of the ASCII SHA-1 seed "12345678901234567890" of RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// RFC 6238 appendix B, SHA-1. The RFC lists 8 digit codes, 6 digit codes are their last 6 digits.
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeRFC6238(t *testing.T) {
+	for _, v := range rfcVectors {
+		code, err := Code(rfcSecret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", v.unix, err)
+		}
+		if code != v.code {
+			t.Errorf("Code(%d) = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestCodeAcceptsLowercaseAndPaddedSecrets(t *testing.T) {
+	code, err := Code(strings.ToLower(rfcSecret)+"====", time.Unix(59, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != "287082" {
+		t.Errorf("Code = %s, want 287082", code)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", time.Now()); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	tests := []struct {
+		name string
+		at   time.Time // Time the code was generated
+		ok   bool
+	}{
+		{"current step", now, true},
+		{"previous step", now.Add(-Period), true},
+		{"next step", now.Add(Period), true},
+		{"two steps ago", now.Add(-2 * Period), false},
+		{"two steps ahead", now.Add(2 * Period), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, tt.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			step, ok := Validate(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && step != Step(tt.at) {
+				t.Errorf("Validate step = %d, want %d (current %d)", step, Step(tt.at), current)
+			}
+		})
+	}
+}
+
+func TestValidateNormalizesInput(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{" 287082 ", "287 082"} {
+		if _, ok := Validate(rfcSecret, code, now); !ok {
+			t.Errorf("Validate(%q) refused a valid code", code)
+		}
+	}
+	for _, code := range []string{"", "28708", "2870820", "abcdef"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate(%q) accepted an invalid code", code)
+		}
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 32 { // 160 bits in base32
+		t.Fatalf("len(secret) = %d, want 32", len(secret))
+	}
+	if _, err := Code(secret, time.Now()); err != nil {
+		t.Errorf("generated secret is not usable: %v", err)
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI(rfcSecret, "Gobete", "user@example.com")
+	want := "otpauth://totp/Gobete:user@example.com?algorithm=SHA1&digits=6&issuer=Gobete&period=30&secret=" + rfcSecret
+	if uri != want {
+		t.Errorf("ProvisioningURI = %s, want %s", uri, want)
+	}
+}
@@ -1,9 +1,9 @@
 package utility
 
 import (
-	"reflect"
-
 	"github.com/go-playground/validator/v10"
+
+	"reflect"
 )
 
 // Map validation tags to friendly messages
@@ -13,6 +13,12 @@ func ValidationLoginMessage(field, tag, param string) string {
 		return field + " is required."
 	case "email":
 		return "Invalid email address format."
+	case "password":
+		return field + " must be 8 to 72 characters long and contain an uppercase letter, a lowercase letter and a digit."
+	case "min":
+		return field + " must be at least " + param + " characters long."
+	case "max":
+		return field + " must be at most " + param + " characters long."
 	default:
 		return field + " is invalid."
 	}
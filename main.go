@@ -1,48 +1,113 @@
 package main
 
 import (
-	"log"
-	"os"
-
-	"github.com/joho/godotenv"
-
 	"github.com/sonyarianto/gobete/internal/modules/scheduler"
+	"github.com/sonyarianto/gobete/internal/modules/user"
+	"github.com/sonyarianto/gobete/internal/systems/config"
+	"github.com/sonyarianto/gobete/internal/systems/container"
 	"github.com/sonyarianto/gobete/internal/systems/db"
 	"github.com/sonyarianto/gobete/internal/systems/http"
+	"github.com/sonyarianto/gobete/internal/systems/logging"
+	"github.com/sonyarianto/gobete/internal/systems/migrate"
+	"gorm.io/gorm"
+
+	"context"
+	"log/slog"
+	"os"
+	"strconv"
 )
 
 func main() {
-	// Load environment variables from .env file
-	err := godotenv.Load()
+	// Load and validate the configuration from the environment, .env and CONFIG_FILE
+	cfg, err := config.Load()
 	if err != nil {
-		log.Fatal("No .env file found or error loading .env file")
+		// Log with the default settings, the configured ones are not known
+		slog.SetDefault(logging.New(config.Default().Log, os.Stderr))
+		fatal("Invalid configuration", err)
+	}
+
+	// Log JSON lines, also for the database and the libraries using the default logger
+	logger := logging.New(cfg.Log, os.Stderr)
+	slog.SetDefault(logger)
+
+	// "gobete migrate up|down|status|create" manages the schema instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		connect := func() (*gorm.DB, error) { return db.Connect(cfg.DB) }
+		if err := migrate.Command(context.Background(), os.Args[2:], connect, os.Stdout); err != nil {
+			fatal("Migration failed", err)
+		}
+		return
 	}
 
 	// Initialize the database connection
-	db.ConnectMySQL()
+	database, err := db.Connect(cfg.DB)
+	if err != nil {
+		fatal("Failed to connect database", err)
+	}
+
+	// Refuse to run against a schema that is behind the binary
+	if cfg.DB.RequireMigrated {
+		if err := migrate.CheckSchema(context.Background(), database); err != nil {
+			fatal("Database schema is not migrated", err)
+		}
+	}
+
+	// Route reads to the read replicas, if any
+	replicas, err := db.UseReplicas(database, cfg.DB)
+	if err != nil {
+		fatal("Failed to set up read replicas", err)
+	}
+
+	// Build the application container: keys, token service, revocation store, mailer and OIDC providers
+	deps, err := container.New(cfg, database)
+	if err != nil {
+		fatal("Failed to build application container", err)
+	}
+
+	// Report the replicas on /readyz, reads fall back to the primary while every replica is down
+	if replicas != nil {
+		deps.Health.RegisterInformational("database_replicas", replicas.Check)
+	}
+
+	// Seed built-in roles and permissions, and the first admin if ADMIN_EMAIL is set
+	if err := user.NewService(deps).SeedRoles(); err != nil {
+		deps.Logger.Error("Failed to seed roles", "error", err)
+	}
 
 	// Start the user session cleanup scheduler
-	scheduler.StartCleanupUserSessionScheduler()
+	scheduler.StartCleanupUserSessionScheduler(deps)
 
 	// Create and configure the Fiber app
-	app := http.NewApp()
-
-	// Determine the port to listen on
-	port := os.Getenv("APP_PORT")
-	if port == "" {
-		// Default port if not specified
-		port = "9000"
+	app, err := http.NewApp(deps)
+	if err != nil {
+		fatal("Failed to create the app", err)
 	}
 
+	// Port to listen on
+	port := strconv.Itoa(cfg.App.Port)
+
 	// Start the server in a separate goroutine
-	log.Printf("Server is starting on :%s", port)
+	logger.Info("Server is starting", "port", port)
 	go func() {
 		if err := app.Listen(":" + port); err != nil {
-			log.Printf("Server stopped: %v", err)
+			logger.Error("Server stopped", "error", err)
 		}
 	}()
-	log.Printf("Server is listening on :%s", port)
+	logger.Info("Server is listening", "port", port)
 
 	// Wait for shutdown signal and gracefully shut down the server
-	http.WaitForShutdown(app)
+	http.WaitForShutdown(app, logger)
+
+	// Stop the replica health checks once no request reads anymore
+	if replicas != nil {
+		if err := replicas.Close(); err != nil {
+			logger.Error("Failed to close database replicas", "error", err)
+		}
+	}
+}
+
+// fatal logs the error that stops the startup and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }